@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// verify-evidence verifies an evidence bundle exported by bc-saas fully offline
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bestchains/bc-saas/pkg/evidence"
+)
+
+var (
+	outputJSON  = flag.Bool("json", false, "print verification report in json")
+	mspRoots    = flag.String("msp-roots", "", "trusted root certificates of msps, comma separated <mspID>=<pem file>, such as Org1MSP=org1-ca.pem")
+	configBlock = flag.String("config-block", "", "trusted channel config block to take root certificates of msps from, such as fetched by `peer channel fetch config`")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-json] [-msp-roots <mspID>=<pem>,...] [-config-block <block>] <evidence.json>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	valid, err := run(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+func run(path string) (bool, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	signed := &evidence.SignedBundle{}
+	if err = json.Unmarshal(raw, signed); err != nil {
+		return false, fmt.Errorf("invalid evidence bundle: %w", err)
+	}
+	trusted, err := loadTrusted()
+	if err != nil {
+		return false, err
+	}
+	report, err := evidence.Verify(signed, trusted)
+	if err != nil {
+		return false, err
+	}
+
+	if *outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return report.Valid, enc.Encode(report)
+	}
+	fmt.Printf("Depository:  %s\n", report.KID)
+	fmt.Printf("Transaction: %s\n", report.TransactionID)
+	fmt.Printf("Block:       %d\n", report.BlockNumber)
+	fmt.Printf("Timestamp:   %s\n", report.Timestamp)
+	for _, root := range report.Roots {
+		fmt.Printf("Root:        %s %s SHA256:%s\n", root.MSPID, root.Subject, root.SHA256)
+	}
+	for _, c := range report.Checks {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("[%s] %s: %s\n", status, c.Name, c.Detail)
+	}
+	if report.Valid {
+		fmt.Println("Evidence is valid")
+	} else {
+		fmt.Println("Evidence is INVALID")
+	}
+	return report.Valid, nil
+}
+
+// loadTrusted loads root certificates of msps from -msp-roots and -config-block
+func loadTrusted() ([]evidence.MSP, error) {
+	trusted := make([]evidence.MSP, 0)
+	if *configBlock != "" {
+		raw, err := os.ReadFile(*configBlock)
+		if err != nil {
+			return nil, err
+		}
+		block := &common.Block{}
+		if err = proto.Unmarshal(raw, block); err != nil {
+			return nil, fmt.Errorf("invalid config block: %w", err)
+		}
+		msps, err := evidence.MSPsFromConfigBlock(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config block: %w", err)
+		}
+		trusted = append(trusted, msps...)
+	}
+	if *mspRoots != "" {
+		for _, item := range strings.Split(*mspRoots, ",") {
+			id, path, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok || id == "" || path == "" {
+				return nil, fmt.Errorf("invalid msp root %q", item)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			trusted = append(trusted, evidence.MSP{ID: id, RootCerts: [][]byte{raw}})
+		}
+	}
+	return trusted, nil
+}
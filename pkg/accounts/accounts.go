@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"time"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/utils"
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidProof is returned if a message doesn't prove owning an account
+	ErrInvalidProof = errors.New("invalid proof of account")
+	// ErrBound is returned if an account is bound to another user
+	ErrBound = errors.New("account is bound to another user")
+)
+
+// Registry binds blockchain accounts to authenticated users
+type Registry struct {
+	db *pg.DB
+}
+
+func NewRegistry(db *pg.DB) *Registry {
+	return &Registry{db: db}
+}
+
+// Bind binds the account which signed msg to user. The payload of msg is its nonce followed
+// by the name of user, so it can't be replayed for others.
+func (r *Registry) Bind(user string, msg *utils.Message) (models.AccountBinding, error) {
+	binding := models.AccountBinding{User: user, CreatedAt: time.Now().Unix()}
+	if user == "" {
+		return binding, errors.Wrap(ErrInvalidProof, "empty user")
+	}
+	address, err := msg.VerifyAgainstArgs(user)
+	if err != nil {
+		return binding, errors.Wrap(ErrInvalidProof, err.Error())
+	}
+	binding.Address = address
+	result, err := r.db.Model(&binding).OnConflict("(address) DO NOTHING").Insert()
+	if err != nil {
+		return binding, err
+	}
+	if result.RowsAffected() > 0 {
+		return binding, nil
+	}
+	// bound already
+	existing := models.AccountBinding{Address: address}
+	if err := r.db.Model(&existing).WherePK().Select(); err != nil {
+		return binding, err
+	}
+	if existing.User != user {
+		return binding, errors.Wrapf(ErrBound, "account %s", address)
+	}
+	return existing, nil
+}
+
+// Unbind an account of user. pg.ErrNoRows if it is not bound to user
+func (r *Registry) Unbind(user string, address string) error {
+	result, err := r.db.Model((*models.AccountBinding)(nil)).Where("address = ?", address).Where(`"user" = ?`, user).Delete()
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// List accounts bound to user, the earliest first
+func (r *Registry) List(user string) ([]models.AccountBinding, error) {
+	bindings := make([]models.AccountBinding, 0)
+	err := r.db.Model(&bindings).Where(`"user" = ?`, user).OrderExpr(`"createdAt" ASC, address ASC`).Select()
+	return bindings, err
+}
+
+// Addresses of accounts bound to user
+func (r *Registry) Addresses(user string) ([]string, error) {
+	bindings, err := r.List(user)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(bindings))
+	for i, b := range bindings {
+		addresses[i] = b.Address
+	}
+	return addresses, nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/utils"
+)
+
+// TestBind_invalidProof tests a message signed for one user can't bind accounts to others
+func TestBind_invalidProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	msg := &utils.Message{Nonce: 1, PublicKey: publicKey}
+	msg.Signature, err = ecdsa.SignASN1(rand.Reader, key, utils.GenerateHash(msg.GeneratePayload("alice")))
+	require.NoError(t, err)
+	_, err = msg.VerifyAgainstArgs("alice")
+	require.NoError(t, err)
+
+	// rejected before touching database
+	r := &Registry{}
+	_, err = r.Bind("bob", msg)
+	assert.True(t, errors.Is(err, ErrInvalidProof), err)
+	_, err = r.Bind("", msg)
+	assert.True(t, errors.Is(err, ErrInvalidProof), err)
+}
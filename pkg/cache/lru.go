@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "bc_saas",
+	Subsystem: "cache",
+	Name:      "requests_total",
+	Help:      "Number of cache lookups by cache and result(hit or miss)",
+}, []string{"cache", "result"})
+
+func init() {
+	prometheus.MustRegister(requestsTotal)
+}
+
+// LRU is an in-memory cache which holds at most size entries, each for ttl by default.
+// The least recently used entry is evicted when it is full.
+type LRU struct {
+	// name labels metrics of this cache
+	name    string
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	// front is the most recently used
+	order *list.List
+	now   func() time.Time
+}
+
+type entry struct {
+	key   string
+	value interface{}
+	// expiresAt is zero if the entry never expires
+	expiresAt time.Time
+}
+
+func NewLRU(name string, size int, ttl time.Duration) *LRU {
+	return &LRU{
+		name:    name,
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns the value of key if it is cached and not expired
+func (c *LRU) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if ok && c.expired(e.Value.(*entry)) {
+		c.remove(e)
+		ok = false
+	}
+	if !ok {
+		requestsTotal.WithLabelValues(c.name, "miss").Inc()
+		return nil, false
+	}
+	requestsTotal.WithLabelValues(c.name, "hit").Inc()
+	c.order.MoveToFront(e)
+	return e.Value.(*entry).value, true
+}
+
+// Set caches value of key for ttl of the cache. Nothing is cached if ttl of the cache is not positive
+func (c *LRU) Set(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL caches value of key for ttl. The value never expires if ttl is not positive,
+// but it can still be evicted.
+func (c *LRU) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete removes key from cache
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+}
+
+// Len returns the number of cached entries, including expired ones not evicted yet
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) expired(e *entry) bool {
+	return !e.expiresAt.IsZero() && c.now().After(e.expiresAt)
+}
+
+func (c *LRU) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*entry).key)
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLRU tests eviction and expiration of cached entries
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	c := NewLRU("test", 2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	// b is the least recently used
+	c.Set("c", 3)
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, 2, c.Len())
+
+	now = now.Add(2 * time.Minute)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	c.Delete("c")
+	assert.Equal(t, 0, c.Len())
+}
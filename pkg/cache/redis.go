@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisTimeout = 3 * time.Second
+
+// RedisStore is a Store in a server speaking the Redis protocol, such as Redis or KeyDB.
+// Keys are prefixed, so that servers can be shared.
+type RedisStore struct {
+	// name labels metrics of this store
+	name   string
+	prefix string
+	client *redis.Client
+}
+
+// NewRedisStore returns a Store in server at rawURL, such as redis://:password@127.0.0.1:6379/0.
+// Use rediss:// for TLS.
+func NewRedisStore(name string, rawURL string, prefix string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse redis url")
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+	// a broken cache falls back to load, so commands are not retried
+	opts.MaxRetries = -1
+	return &RedisStore{
+		name:   name,
+		prefix: prefix,
+		client: redis.NewClient(opts),
+	}, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err == redis.Nil {
+		requestsTotal.WithLabelValues(s.name, "miss").Inc()
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	requestsTotal.WithLabelValues(s.name, "hit").Inc()
+	return value, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
+
+// Close closes connections to server
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
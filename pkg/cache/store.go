@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Store caches encoded values, which can be shared by replicas such as a Redis server
+type Store interface {
+	// Get returns the value of key and whether it is cached
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set caches value of key for ttl. The value is cached until evicted if ttl is 0
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// memoryStore is a Store in an LRU of this process
+type memoryStore struct {
+	lru *LRU
+}
+
+// NewMemoryStore returns a Store which holds at most size values in memory
+func NewMemoryStore(name string, size int) Store {
+	return &memoryStore{lru: NewLRU(name, size, 0)}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	value, ok := s.lru.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return value.([]byte), true, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.lru.SetWithTTL(key, value, ttl)
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		s.lru.Delete(key)
+	}
+	return nil
+}
+
+// Fetch returns the cached value of key, or loads, caches and returns it. Errors of store are
+// logged and the value is loaded instead, so a broken cache only slows requests down.
+// Load is always called if store is nil.
+func Fetch(ctx context.Context, store Store, key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	if store == nil {
+		return load()
+	}
+	value, ok, err := store.Get(ctx, key)
+	if err != nil {
+		klog.Errorf("[Error] get %s from cache: %s", key, err)
+	}
+	if ok {
+		return value, nil
+	}
+	value, err = load()
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Set(ctx, key, value, ttl); err != nil {
+		klog.Errorf("[Error] set %s to cache: %s", key, err)
+	}
+	return value, nil
+}
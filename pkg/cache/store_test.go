@@ -0,0 +1,190 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFetch tests values are loaded once, and errors are neither cached nor fatal
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore("test", 10)
+	loads := 0
+	load := func() ([]byte, error) {
+		loads++
+		return []byte("value"), nil
+	}
+	for i := 0; i < 2; i++ {
+		value, err := Fetch(ctx, store, "key", 0, load)
+		assert.NoError(t, err)
+		assert.Equal(t, "value", string(value))
+	}
+	assert.Equal(t, 1, loads)
+
+	_, err := Fetch(ctx, store, "broken", 0, func() ([]byte, error) { return nil, errors.New("unavailable") })
+	assert.Error(t, err)
+	_, ok, _ := store.Get(ctx, "broken")
+	assert.False(t, ok)
+
+	// a broken cache falls back to load
+	broken, err := NewRedisStore("test", "redis://127.0.0.1:1", "")
+	require.NoError(t, err)
+	defer broken.Close()
+	value, err := Fetch(ctx, broken, "key", 0, load)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", string(value))
+	assert.Equal(t, 2, loads)
+}
+
+// TestMemoryStore tests values without ttl never expire
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore("test", 10).(*memoryStore)
+	now := time.Now()
+	store.lru.now = func() time.Time { return now }
+
+	assert.NoError(t, store.Set(ctx, "immutable", []byte("a"), 0))
+	assert.NoError(t, store.Set(ctx, "volatile", []byte("b"), time.Second))
+	now = now.Add(time.Hour)
+	value, ok, err := store.Get(ctx, "immutable")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(value))
+	_, ok, _ = store.Get(ctx, "volatile")
+	assert.False(t, ok)
+
+	assert.NoError(t, store.Delete(ctx, "immutable"))
+	_, ok, _ = store.Get(ctx, "immutable")
+	assert.False(t, ok)
+}
+
+// TestRedisStore tests commands sent to a fake server speaking RESP
+func TestRedisStore(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	server := &fakeRedis{values: make(map[string]string)}
+	go server.serve(l)
+
+	store, err := NewRedisStore("test", fmt.Sprintf("redis://:secret@%s/2", l.Addr()), "net_")
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := context.Background()
+
+	_, ok, err := store.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, store.Set(ctx, "key", []byte("line\r\nbreak"), time.Minute))
+	value, ok, err := store.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "line\r\nbreak", string(value))
+	assert.NoError(t, store.Delete(ctx, "key"))
+	_, ok, _ = store.Get(ctx, "key")
+	assert.False(t, ok)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	// RESP3 is not supported by the fake server, so client falls back to AUTH
+	assert.Equal(t, []string{"hello 3 auth default secret", "auth secret", "select 2", "get net_key", "set net_key line\r\nbreak ex 60", "get net_key", "del net_key", "get net_key"}, server.commands)
+}
+
+// fakeRedis serves GET, SET and DEL of RESP2
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func (f *fakeRedis) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			r := bufio.NewReader(c)
+			for {
+				args, err := readCommand(r)
+				if err != nil {
+					return
+				}
+				io.WriteString(c, f.reply(args))
+			}
+		}(c)
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+	switch strings.ToUpper(args[0]) {
+	case "HELLO":
+		return "-ERR unknown command 'HELLO'\r\n"
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		delete(f.values, args[1])
+		return ":1\r\n"
+	default:
+		return "+OK\r\n"
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
@@ -17,16 +17,31 @@ limitations under the License.
 package contracts
 
 import (
+	"context"
+	"crypto/x509"
 	"strconv"
+	"time"
 
 	"github.com/bestchains/bc-explorer/pkg/network"
+	"github.com/bestchains/bc-saas/pkg/cache"
+	"github.com/bestchains/bc-saas/pkg/models"
 	"github.com/bestchains/bc-saas/pkg/utils"
+	"github.com/go-pg/pg/v10/orm"
 	gwclient "github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
 )
 
+// cache key of the total number of depositories
+const cacheKeyTotal = "total"
+
 type Depository struct {
 	contract *gwclient.Contract
+
+	// cache of evaluated results. Not cached if nil
+	cache cache.Store
+	// cacheTTL of totals and nonces, which change with new depositories
+	cacheTTL time.Duration
 }
 
 func NewDepository(client *network.FabricClient, contract string) (*Depository, error) {
@@ -41,6 +56,55 @@ func NewDepository(client *network.FabricClient, contract string) (*Depository,
 	return basic, nil
 }
 
+// EnableCache caches evaluated results in store. A value never changes once put, so values are cached
+// until evicted, while totals and nonces are cached for ttl, or not cached if ttl is 0.
+func (depository *Depository) EnableCache(store cache.Store, ttl time.Duration) {
+	depository.cache = store
+	depository.cacheTTL = ttl
+}
+
+// DepositoryCreated invalidates the cached total and nonces changed by depository d.
+// It is a notifier of events.
+func (depository *Depository) DepositoryCreated(_ orm.DB, d *models.Depository) error {
+	keys := []string{cacheKeyTotal, nonceCacheKey(d.Operator)}
+	if d.Owner != d.Operator {
+		keys = append(keys, nonceCacheKey(d.Owner))
+	}
+	depository.invalidate(keys...)
+	return nil
+}
+
+// invalidate deletes cached keys. Stale entries expire soon anyway, so errors are only logged
+func (depository *Depository) invalidate(keys ...string) {
+	if depository.cache == nil {
+		return
+	}
+	if err := depository.cache.Delete(context.TODO(), keys...); err != nil {
+		klog.Errorf("[Error] invalidate cached %v: %s", keys, err)
+	}
+}
+
+// evaluate evaluates transaction name with args, and caches the result with key
+func (depository *Depository) evaluate(key string, immutable bool, name string, args ...string) ([]byte, error) {
+	store, ttl := depository.cache, depository.cacheTTL
+	if immutable {
+		ttl = 0
+	} else if ttl <= 0 {
+		store = nil
+	}
+	return cache.Fetch(context.TODO(), store, key, ttl, func() ([]byte, error) {
+		result, err := depository.contract.EvaluateTransaction(name, args...)
+		if err != nil {
+			return nil, utils.ParseTxError(err)
+		}
+		return result, nil
+	})
+}
+
+func nonceCacheKey(account string) string {
+	return "nonce:" + account
+}
+
 func (depository *Depository) Initialize() error {
 	_, err := depository.contract.SubmitTransaction("Initialize")
 	if err != nil {
@@ -50,17 +114,17 @@ func (depository *Depository) Initialize() error {
 }
 
 func (depository *Depository) CurrentNonce(account string) (uint64, error) {
-	result, err := depository.contract.EvaluateTransaction("Current", account)
+	result, err := depository.evaluate(nonceCacheKey(account), false, "Current", account)
 	if err != nil {
-		return 0, utils.ParseTxError(err)
+		return 0, err
 	}
 	return strconv.ParseUint(string(result), 10, 64)
 }
 
 func (depository *Depository) Total() (uint64, error) {
-	result, err := depository.contract.EvaluateTransaction("Total")
+	result, err := depository.evaluate(cacheKeyTotal, false, "Total")
 	if err != nil {
-		return 0, utils.ParseTxError(err)
+		return 0, err
 	}
 	return strconv.ParseUint(string(result), 10, 64)
 }
@@ -70,6 +134,7 @@ func (depository *Depository) PutUntrustValue(val string) (string, error) {
 	if err != nil {
 		return "", utils.ParseTxError(err)
 	}
+	depository.invalidate(cacheKeyTotal)
 
 	return string(kid), nil
 }
@@ -80,25 +145,39 @@ func (depository *Depository) PutValue(msg *utils.Message, val string) (string,
 		return "", err
 	}
 	kid, err := depository.contract.SubmitTransaction("PutValue", string(rawMsg), val)
+	// nonce of sender is increased, or the cached one may be stale if rejected
+	if sender, err := messageSender(msg); err == nil {
+		depository.invalidate(nonceCacheKey(sender))
+	}
 	if err != nil {
 		return "", utils.ParseTxError(err)
 	}
+	depository.invalidate(cacheKeyTotal)
 
 	return string(kid), nil
 }
 
+// messageSender returns the account which signs msg
+func messageSender(msg *utils.Message) (string, error) {
+	pub, err := x509.ParsePKIXPublicKey(msg.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return utils.FromPublicKey(pub)
+}
+
 func (depository *Depository) GetValueByIndex(index string) (string, error) {
-	result, err := depository.contract.EvaluateTransaction("GetValueByIndex", index)
+	result, err := depository.evaluate("value:index:"+index, true, "GetValueByIndex", index)
 	if err != nil {
-		return "", utils.ParseTxError(err)
+		return "", err
 	}
 	return string(result), nil
 }
 
 func (depository *Depository) GetValueByKID(kid string) (string, error) {
-	result, err := depository.contract.EvaluateTransaction("GetValueByKID", kid)
+	result, err := depository.evaluate("value:kid:"+kid, true, "GetValueByKID", kid)
 	if err != nil {
-		return "", utils.ParseTxError(err)
+		return "", err
 	}
 	return string(result), nil
 }
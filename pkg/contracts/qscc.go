@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package contracts
+
+import (
+	"strconv"
+
+	"github.com/bestchains/bc-explorer/pkg/network"
+	"github.com/bestchains/bc-saas/pkg/utils"
+	gwclient "github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// QSCC queries the ledger through fabric's query system chaincode
+type QSCC struct {
+	contract *gwclient.Contract
+	channel  string
+}
+
+func NewQSCC(client *network.FabricClient, channel string) (*QSCC, error) {
+	if client == nil {
+		return nil, errors.New("invalid arguments")
+	}
+
+	fabChannel := client.Channel(channel)
+	qscc := &QSCC{
+		contract: fabChannel.GetContract("qscc"),
+		channel:  fabChannel.Name(),
+	}
+
+	return qscc, nil
+}
+
+// GetTransactionByID returns the processed transaction(envelope and validation code) of txID
+func (qscc *QSCC) GetTransactionByID(txID string) (*peer.ProcessedTransaction, error) {
+	result, err := qscc.contract.EvaluateTransaction("GetTransactionByID", qscc.channel, txID)
+	if err != nil {
+		return nil, utils.ParseTxError(err)
+	}
+	tx := &peer.ProcessedTransaction{}
+	if err = proto.Unmarshal(result, tx); err != nil {
+		return nil, errors.Wrap(err, "unmarshal processed transaction")
+	}
+	return tx, nil
+}
+
+// GetTransactionTimestamp returns the timestamp(unix seconds) recorded on ledger for txID
+func (qscc *QSCC) GetTransactionTimestamp(txID string) (int64, error) {
+	tx, err := qscc.GetTransactionByID(txID)
+	if err != nil {
+		return 0, err
+	}
+	return transactionTimestamp(txID, tx)
+}
+
+func transactionTimestamp(txID string, tx *peer.ProcessedTransaction) (int64, error) {
+	chdr, err := utils.ChannelHeaderFromEnvelope(tx.GetTransactionEnvelope())
+	if err != nil {
+		return 0, err
+	}
+	if chdr.GetTimestamp() == nil {
+		return 0, errors.Errorf("transaction %s has no timestamp", txID)
+	}
+	return chdr.GetTimestamp().GetSeconds(), nil
+}
+
+// GetBlockByTxID returns the block which contains txID
+func (qscc *QSCC) GetBlockByTxID(txID string) (*common.Block, error) {
+	result, err := qscc.contract.EvaluateTransaction("GetBlockByTxID", qscc.channel, txID)
+	if err != nil {
+		return nil, utils.ParseTxError(err)
+	}
+	return unmarshalBlock(result)
+}
+
+// GetBlockByNumber returns the block with number
+func (qscc *QSCC) GetBlockByNumber(number uint64) (*common.Block, error) {
+	result, err := qscc.contract.EvaluateTransaction("GetBlockByNumber", qscc.channel, strconv.FormatUint(number, 10))
+	if err != nil {
+		return nil, utils.ParseTxError(err)
+	}
+	return unmarshalBlock(result)
+}
+
+// GetChainInfo returns height and hashes of the latest block
+func (qscc *QSCC) GetChainInfo() (*common.BlockchainInfo, error) {
+	result, err := qscc.contract.EvaluateTransaction("GetChainInfo", qscc.channel)
+	if err != nil {
+		return nil, utils.ParseTxError(err)
+	}
+	info := &common.BlockchainInfo{}
+	if err = proto.Unmarshal(result, info); err != nil {
+		return nil, errors.Wrap(err, "unmarshal blockchain info")
+	}
+	return info, nil
+}
+
+func unmarshalBlock(raw []byte) (*common.Block, error) {
+	block := &common.Block{}
+	if err := proto.Unmarshal(raw, block); err != nil {
+		return nil, errors.Wrap(err, "unmarshal block")
+	}
+	return block, nil
+}
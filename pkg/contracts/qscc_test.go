@@ -0,0 +1,52 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package contracts
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func testProcessedTransaction(t *testing.T, chdr *common.ChannelHeader) *peer.ProcessedTransaction {
+	header, err := proto.Marshal(chdr)
+	require.NoError(t, err)
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: header}})
+	require.NoError(t, err)
+	return &peer.ProcessedTransaction{TransactionEnvelope: &common.Envelope{Payload: payload}}
+}
+
+// TestTransactionTimestamp tests the timestamp is read from the channel header of transaction
+func TestTransactionTimestamp(t *testing.T) {
+	tx := testProcessedTransaction(t, &common.ChannelHeader{TxId: "tx1", Timestamp: &timestamppb.Timestamp{Seconds: 1682406290, Nanos: 500}})
+	timestamp, err := transactionTimestamp("tx1", tx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1682406290), timestamp)
+
+	tx = testProcessedTransaction(t, &common.ChannelHeader{TxId: "tx2"})
+	_, err = transactionTimestamp("tx2", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has no timestamp")
+
+	_, err = transactionTimestamp("tx3", &peer.ProcessedTransaction{})
+	assert.Error(t, err)
+}
@@ -106,10 +106,20 @@ const (
             "style": "",
             "size": 12
         },
+        {
+            "text": "TSA Timestamp: %s",
+            "inputs": [
+                "tsaTimestamp"
+            ],
+            "x": 180,
+            "y": 560,
+            "style": "",
+            "size": 12
+        },
         {
             "text": "I promise that the content I upload does not violate any laws or regulations or infringe upon the rights or interests of others. \n I understand and agree that I will be solely responsible for any legal consequences and corresponding legal liabilities arising from the content I upload。",
             "x": 90,
-            "y": 560,
+            "y": 600,
             "style": "",
             "size": 12
         },
@@ -119,7 +129,7 @@ const (
                 "currentDate"
             ],
             "x": 400,
-            "y": 680,
+            "y": 720,
             "style": "",
             "size": 12
         }
@@ -200,10 +210,20 @@ const (
             "style": "",
             "size": 12
         },
+        {
+            "text": "可信时间戳: %s",
+            "inputs": [
+                "tsaTimestamp"
+            ],
+            "x": 180,
+            "y": 560,
+            "style": "",
+            "size": 12
+        },
         {
             "text": "承诺上传内容不存在任何违反法律法规或侵犯他人权利或权益的情况，理解并同意对其上传的内容自行承担因此产生的一切法律后果及相应法律责任。",
             "x": 90,
-            "y": 560,
+            "y": 600,
             "style": "",
             "size": 12
         },
@@ -213,7 +233,7 @@ const (
                 "currentDate"
             ],
             "x": 400,
-            "y": 680,
+            "y": 720,
             "style": "",
             "size": 12
         }
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+// CountMode is how depositories matching a condition are counted
+type CountMode string
+
+const (
+	// CountExact counts all matching depositories, which gets slow with many of them
+	CountExact CountMode = "exact"
+	// CountEstimate takes the number of rows estimated by the query planner
+	CountEstimate CountMode = "estimate"
+	// CountNone skips counting
+	CountNone CountMode = "none"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in depositories ordered by trustedTimestamp and kid, newest first.
+// Unlike from, a cursor keeps its position when new depositories arrive.
+type Cursor struct {
+	TrustedTimestamp int64  `json:"t"`
+	KID              string `json:"k"`
+	// Backward lists depositories before this position, i.e. the previous page
+	Backward bool `json:"b,omitempty"`
+}
+
+// Encode returns the opaque token of cursor
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// ParseCursor parses a token returned by Cursor.Encode
+func ParseCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(raw, c); err != nil || c.KID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// cond returns the condition of depositories after cursor in its direction, and their order
+func (c *Cursor) cond() (string, []interface{}, string) {
+	if c.Backward {
+		return `("trustedTimestamp", kid) > (?, ?)`, []interface{}{c.TrustedTimestamp, c.KID}, `"trustedTimestamp" asc, kid asc`
+	}
+	return `("trustedTimestamp", kid) < (?, ?)`, []interface{}{c.TrustedTimestamp, c.KID}, `"trustedTimestamp" desc, kid desc`
+}
+
+// Page is a page of listed depositories
+type Page struct {
+	Data []models.Depository
+	// Count of all matching depositories, -1 if not counted
+	Count int64
+	// Next and Prev are cursors of adjacent pages, nil if there is none
+	Next, Prev *Cursor
+}
+
+// newPage returns the page of result, which has one more depository than arg.Size
+// if there are more in the direction of arg.Cursor
+func newPage(result []models.Depository, count int64, arg DepositoryCond) Page {
+	page := Page{Data: result, Count: count}
+	more := arg.Size != 0 && len(result) > arg.Size
+	if more {
+		page.Data = result[:arg.Size]
+	}
+	backward := arg.Cursor != nil && arg.Cursor.Backward
+	if backward {
+		for i, j := 0, len(page.Data)-1; i < j; i, j = i+1, j-1 {
+			page.Data[i], page.Data[j] = page.Data[j], page.Data[i]
+		}
+	}
+	// pages of ranked, sorted results or all depositories have no cursors
+	if arg.Size == 0 || arg.Q != "" || len(arg.Sort) > 0 || len(page.Data) == 0 {
+		return page
+	}
+	first, last := page.Data[0], page.Data[len(page.Data)-1]
+	if more || backward {
+		page.Next = &Cursor{TrustedTimestamp: last.TrustedTimestamp, KID: last.KID}
+	}
+	if (backward && more) || (!backward && (arg.Cursor != nil || arg.From > 0)) {
+		page.Prev = &Cursor{TrustedTimestamp: first.TrustedTimestamp, KID: first.KID, Backward: true}
+	}
+	return page
+}
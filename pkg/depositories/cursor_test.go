@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/sqlite"
+)
+
+func kids(page Page) []string {
+	result := make([]string, 0, len(page.Data))
+	for _, d := range page.Data {
+		result = append(result, d.KID)
+	}
+	return result
+}
+
+// TestCursor tests paging depositories with cursors back and forth
+func TestCursor(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "bc-saas.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	// kid1 and kid2 have the same timestamp
+	depositories := make([]*models.Depository, 0)
+	for i, ts := range []int64{100, 100, 200, 300, 400} {
+		depositories = append(depositories, &models.Depository{KID: fmt.Sprintf("kid%d", i+1), TrustedTimestamp: ts})
+	}
+	require.NoError(t, store.Commit(depositories, models.Checkpoint{Channel: "channel", Contract: "depository"}))
+	h, err := NewSQLiteHandler(store, nil, "", nil)
+	require.NoError(t, err)
+
+	page, err := h.List(DepositoryCond{Size: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid5", "kid4"}, kids(page))
+	assert.Equal(t, int64(5), page.Count)
+	assert.Nil(t, page.Prev)
+	require.NotNil(t, page.Next)
+
+	// a new depository does not shift pages
+	require.NoError(t, store.Commit([]*models.Depository{{KID: "kid6", TrustedTimestamp: 500}}, models.Checkpoint{Channel: "channel", Contract: "depository"}))
+
+	next, err := ParseCursor(page.Next.Encode())
+	require.NoError(t, err)
+	page, err = h.List(DepositoryCond{Size: 2, Cursor: next, Count: CountNone})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid3", "kid2"}, kids(page))
+	assert.Equal(t, int64(-1), page.Count)
+
+	page, err = h.List(DepositoryCond{Size: 2, Cursor: page.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid1"}, kids(page))
+	assert.Nil(t, page.Next)
+	require.NotNil(t, page.Prev)
+
+	page, err = h.List(DepositoryCond{Size: 2, Cursor: page.Prev})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid3", "kid2"}, kids(page))
+	page, err = h.List(DepositoryCond{Size: 2, Cursor: page.Prev})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid5", "kid4"}, kids(page))
+	require.NotNil(t, page.Prev)
+	page, err = h.List(DepositoryCond{Size: 2, Cursor: page.Prev})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid6"}, kids(page))
+	assert.Nil(t, page.Prev)
+
+	// offset pages also have cursors
+	page, err = h.List(DepositoryCond{From: 2, Size: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid4", "kid3"}, kids(page))
+	assert.NotNil(t, page.Next)
+	assert.NotNil(t, page.Prev)
+
+	_, err = ParseCursor("invalid")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
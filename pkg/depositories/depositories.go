@@ -17,81 +17,319 @@ limitations under the License.
 package depositories
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/bestchains/bc-saas/pkg/cache"
 	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/tsa"
 	"github.com/bestchains/bc-saas/pkg/utils"
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 )
 
-type dbHandler struct {
+// certificates verifies timestamp tokens and renders certificates of depositories
+type certificates struct {
 	// template images for depository in different style
 	templateBaseImages map[Style]string
 	// config for ttf font file
 	ttfFontPath string
-
-	db *pg.DB
+	// tsaClient verifies timestamp tokens of depositories. Optional
+	tsaClient *tsa.Client
 }
 
-func NewDBHandler(db *pg.DB, templateBaseImages map[Style]string, ttpfFontPath string) (Interface, error) {
+func newCertificates(templateBaseImages map[Style]string, ttpfFontPath string, tsaClient *tsa.Client) (certificates, error) {
 	// check tempalte image and ttf font file exists
 	for style, templateImage := range templateBaseImages {
 		if _, ok := CertificateStyles[style]; !ok {
-			return nil, fmt.Errorf("invalid certificate style %s", style)
+			return certificates{}, fmt.Errorf("invalid certificate style %s", style)
 		}
 		if _, err := os.Stat(templateImage); os.IsNotExist(err) {
-			return nil, fmt.Errorf("template image %s for %s does not exist", templateImage, style)
+			return certificates{}, fmt.Errorf("template image %s for %s does not exist", templateImage, style)
 		}
 	}
 	if ttpfFontPath != "" {
 		if _, err := os.Stat(ttpfFontPath); os.IsNotExist(err) {
-			return nil, fmt.Errorf("ttf font file %s does not exist", ttpfFontPath)
+			return certificates{}, fmt.Errorf("ttf font file %s does not exist", ttpfFontPath)
 		}
 	}
+	return certificates{templateBaseImages: templateBaseImages, ttfFontPath: ttpfFontPath, tsaClient: tsaClient}, nil
+}
+
+// ErrDisputed is returned when a certificate of a disputed depository is requested
+var ErrDisputed = errors.New("depository is disputed")
 
-	return &dbHandler{db: db, templateBaseImages: templateBaseImages, ttfFontPath: ttpfFontPath}, nil
+type dbHandler struct {
+	certificates
+
+	db *pg.DB
+	// cache of depositories by kid for cacheTTL. Optional
+	cache    cache.Store
+	cacheTTL time.Duration
 }
 
-func (h *dbHandler) List(arg DepositoryCond) ([]models.Depository, int64, error) {
+// NewDBHandler creates a handler of depositories in db. Depositories got by kid are cached in store for ttl,
+// as they are rewritten by repair-timestamps and reindex. Not cached if store is nil or ttl is 0.
+func NewDBHandler(db *pg.DB, templateBaseImages map[Style]string, ttpfFontPath string, tsaClient *tsa.Client, store cache.Store, ttl time.Duration) (Interface, error) {
+	c, err := newCertificates(templateBaseImages, ttpfFontPath, tsaClient)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		store = nil
+	}
+	return &dbHandler{db: db, certificates: c, cache: store, cacheTTL: ttl}, nil
+}
+
+func (h *dbHandler) List(arg DepositoryCond) (Page, error) {
 	result := make([]models.Depository, 0)
-	cond, params := arg.ToCond()
-	klog.V(5).Infof(" dbHandler list query %v %v\n", cond, params)
+	q, search := h.filter(h.db.Model(&result).ExcludeColumn("searchVector"), arg)
+	count, err := h.count(q, arg.Count)
+	if err != nil {
+		return Page{}, err
+	}
+	switch {
+	case len(arg.Sort) > 0:
+		q = q.OrderExpr(orderBy(arg.Sort)).Offset(arg.From)
+	case search != "":
+		q = q.OrderExpr(`ts_rank("searchVector", ?::tsquery) desc, "trustedTimestamp" desc, kid desc`, search).Offset(arg.From)
+	case arg.Cursor != nil:
+		cursorCond, cursorParams, order := arg.Cursor.cond()
+		q = q.Where(cursorCond, cursorParams...).OrderExpr(order)
+	default:
+		q = q.OrderExpr(`"trustedTimestamp" desc, kid desc`).Offset(arg.From)
+	}
+	if arg.Size != 0 {
+		// one more to tell whether there is a next page
+		q = q.Limit(arg.Size + 1)
+	}
+	if err := q.Select(); err != nil {
+		return Page{}, err
+	}
+	if search != "" {
+		for i := range result {
+			highlight(&result[i], arg.Q)
+		}
+	}
+	if err := h.moderate(result); err != nil {
+		return Page{}, err
+	}
+
+	return newPage(result, count, arg), nil
+}
 
-	q := h.db.Model(&result)
+// visible excludes depositories hidden by moderation from q unless arg includes them
+func visible(q *orm.Query, arg DepositoryCond) *orm.Query {
+	if arg.IncludeHidden {
+		return q
+	}
+	return q.Where(`kid NOT IN (SELECT kid FROM ? WHERE status = ?)`,
+		pg.Ident(models.TableName((*models.Moderation)(nil))), models.ModerationHidden)
+}
+
+// moderate sets moderation status of depositories
+func (h *dbHandler) moderate(result []models.Depository) error {
+	if len(result) == 0 {
+		return nil
+	}
+	kids := make([]string, len(result))
+	for i := range result {
+		kids[i] = result[i].KID
+	}
+	moderations := make([]models.Moderation, 0)
+	if err := h.db.Model(&moderations).Column("kid", "status").Where("kid IN (?)", pg.In(kids)).Select(); err != nil {
+		return err
+	}
+	status := make(map[string]models.ModerationStatus, len(moderations))
+	for _, m := range moderations {
+		status[m.KID] = m.Status
+	}
+	for i := range result {
+		result[i].Moderation = status[result[i].KID]
+	}
+	return nil
+}
+
+// filter selects depositories matching arg with q, and returns the full-text search query if any
+func (h *dbHandler) filter(q *orm.Query, arg DepositoryCond) (*orm.Query, string) {
+	cond, params := arg.ToCond()
+	klog.V(5).Infof(" dbHandler query %v %v\n", cond, params)
 	for i := 0; i < len(cond); i++ {
 		q = q.Where(cond[i], params[i])
 	}
-	c, err := q.Count()
-	if err != nil {
-		return result, 0, err
+	search := models.SearchQuery(arg.Q)
+	if search != "" {
+		q = q.Where(`"searchVector" @@ ?::tsquery`, search)
 	}
-	q = q.Order(`trustedTimestamp desc`)
-	if arg.Size != 0 {
-		q = q.Limit(arg.Size).Offset(arg.From)
+	switch {
+	case arg.Accounts == nil:
+	case len(arg.Accounts) == 0:
+		q = q.Where("false")
+	default:
+		q = q.Where(`(owner IN (?) OR operator IN (?))`, pg.In(arg.Accounts), pg.In(arg.Accounts))
 	}
-	if err := q.Select(); err != nil {
-		return result, 0, err
+	return visible(q, arg), search
+}
+
+// Stats aggregates depositories matching arg
+func (h *dbHandler) Stats(arg DepositoryCond, opts StatsOptions) ([]StatsBucket, error) {
+	var rows []struct {
+		Key         string    `pg:"key"`
+		Bucket      time.Time `pg:"bucket"`
+		Count       int64     `pg:"count"`
+		ContentSize int64     `pg:"contentSize"`
+	}
+	q, _ := h.filter(h.db.Model((*models.Depository)(nil)), arg)
+	q = q.ColumnExpr(`count(*) AS count`).ColumnExpr(`coalesce(sum("contentSize"), 0) AS "contentSize"`)
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	switch {
+	case opts.Group.IsTime():
+		q = q.ColumnExpr(`date_trunc(?, to_timestamp("trustedTimestamp") AT TIME ZONE ?) AS bucket`, string(opts.Group), loc.String()).
+			Group("bucket").Order("bucket")
+	case opts.Group.IsBreakdown():
+		q = q.ColumnExpr(`? AS key`, pg.SafeQuery(groupColumns[opts.Group])).
+			GroupExpr(groupColumns[opts.Group]).OrderExpr(`count desc, key asc`)
+		if opts.Limit > 0 {
+			q = q.Limit(opts.Limit)
+		}
+	}
+	if err := q.Select(&rows); err != nil {
+		return nil, err
 	}
 
-	return result, int64(c), nil
+	result := make([]StatsBucket, 0, len(rows))
+	for _, row := range rows {
+		bucket := StatsBucket{Key: row.Key, Count: row.Count, ContentSize: row.ContentSize}
+		if opts.Group.IsTime() {
+			// bucket is the local time in loc
+			y, m, d := row.Bucket.Date()
+			bucket = timeBucket(time.Date(y, m, d, 0, 0, 0, 0, loc), opts.Group)
+			bucket.Count, bucket.ContentSize = row.Count, row.ContentSize
+		}
+		result = append(result, bucket)
+	}
+	return result, nil
+}
+
+func (h *dbHandler) Export(arg DepositoryCond, fn func(d *models.Depository) error) error {
+	q, search := h.filter(h.db.Model((*models.Depository)(nil)).ExcludeColumn("searchVector"), arg)
+	switch {
+	case len(arg.Sort) > 0:
+		q = q.OrderExpr(orderBy(arg.Sort))
+	case search != "":
+		q = q.OrderExpr(`ts_rank("searchVector", ?::tsquery) desc, "trustedTimestamp" desc, kid desc`, search)
+	default:
+		q = q.OrderExpr(`"trustedTimestamp" desc, kid desc`)
+	}
+	return q.ForEach(fn)
+}
+
+// count counts depositories selected by q in mode
+func (h *dbHandler) count(q *orm.Query, mode CountMode) (int64, error) {
+	switch mode {
+	case CountNone:
+		return -1, nil
+	case CountEstimate:
+		var plan string
+		if _, err := h.db.QueryOne(pg.Scan(&plan), `EXPLAIN (FORMAT JSON) ?`, q); err != nil {
+			return 0, err
+		}
+		var plans []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			} `json:"Plan"`
+		}
+		if err := json.Unmarshal([]byte(plan), &plans); err != nil || len(plans) == 0 {
+			return 0, fmt.Errorf("parse query plan %s", plan)
+		}
+		return int64(plans[0].Plan.Rows), nil
+	default:
+		c, err := q.Count()
+		return int64(c), err
+	}
 }
 
 func (h *dbHandler) Get(arg DepositoryCond) (models.Depository, error) {
+	result, err := h.get(arg)
+	if err != nil {
+		return result, err
+	}
+	moderated := []models.Depository{result}
+	if err := h.moderate(moderated); err != nil {
+		return result, err
+	}
+	result = moderated[0]
+	if result.Moderation == models.ModerationHidden && !arg.IncludeHidden {
+		return result, pg.ErrNoRows
+	}
+	h.verifyTimestampToken(&result)
+	return result, nil
+}
+
+// get selects a depository regardless of moderation. It is cached if it is got by kid only.
+func (h *dbHandler) get(arg DepositoryCond) (models.Depository, error) {
 	result := models.Depository{}
 	cond, params := arg.ToCond()
-	q := h.db.Model(&result)
-	for i := 0; i < len(cond); i++ {
-		q = q.Where(cond[i], params[i])
+	load := func() ([]byte, error) {
+		q := h.db.Model(&result).ExcludeColumn("searchVector")
+		for i := 0; i < len(cond); i++ {
+			q = q.Where(cond[i], params[i])
+		}
+		if err := q.Select(); err != nil {
+			return nil, err
+		}
+		return json.Marshal(result)
+	}
+	if h.cache == nil || arg.KID == "" || len(cond) != 1 {
+		_, err := load()
+		return result, err
 	}
-	err := q.Select()
+	raw, err := cache.Fetch(context.TODO(), h.cache, "depository:"+arg.KID, h.cacheTTL, load)
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(raw, &result)
 	return result, err
 }
 
+// verifyTimestampToken verifies timestamp token of depository if it has one.
+// Tokens are never verified without trusted roots of TSA.
+func (c certificates) verifyTimestampToken(depository *models.Depository) {
+	if len(depository.TimestampToken) == 0 {
+		return
+	}
+	verified := false
+	if c.tsaClient.Trusted() {
+		_, err := c.tsaClient.Verify(depository.TimestampToken, []byte(depository.ContentID))
+		if err != nil {
+			klog.Errorf("[Error] verify timestamp token of depository %s: %s", depository.KID, err)
+		}
+		verified = err == nil
+	}
+	depository.TimestampTokenVerified = &verified
+}
+
 // GetCertificate get certificate for depository. Only support two styles: CN and ENG
 func (h *dbHandler) GetCertificate(arg DepositoryCond, style Style) ([]byte, error) {
+	return h.render(style, func() (models.Depository, error) {
+		depository, err := h.Get(arg)
+		if err == nil && depository.Moderation == models.ModerationDisputed {
+			return depository, ErrDisputed
+		}
+		return depository, err
+	})
+}
+
+// render renders certificate of the depository returned by get in style
+func (c certificates) render(style Style, get func() (models.Depository, error)) ([]byte, error) {
 	// validate certificate style
 	if style == "" {
 		style = StyleCN
@@ -107,16 +345,22 @@ func (h *dbHandler) GetCertificate(arg DepositoryCond, style Style) ([]byte, err
 		return nil, err
 	}
 	// set image
-	template.Image = h.templateBaseImages[style]
+	template.Image = c.templateBaseImages[style]
 
 	// get depository
-	depository, err := h.Get(arg)
+	depository, err := get()
 	if err != nil {
 		return nil, err
 	}
 
+	// only a verified token can be presented
+	tsaTimestamp := "-"
+	if depository.TimestampTokenVerified != nil && *depository.TimestampTokenVerified {
+		tsaTimestamp = time.Unix(depository.TimestampTokenTime, 0).Format("2006-01-02 15:04:05")
+	}
+
 	return template.Render(utils.RenderOpts{
-		TtfFontPath: h.ttfFontPath,
+		TtfFontPath: c.ttfFontPath,
 		Inputs: map[string]string{
 			"name":             depository.Name,
 			"owner":            depository.Owner,
@@ -124,6 +368,7 @@ func (h *dbHandler) GetCertificate(arg DepositoryCond, style Style) ([]byte, err
 			"contentID":        depository.ContentID,
 			"transactionHash":  depository.TransactionID,
 			"trustedTimestamp": time.Unix(depository.TrustedTimestamp, 0).Format("2006-01-02 15:04:05"),
+			"tsaTimestamp":     tsaTimestamp,
 			"currentDate":      time.Now().Format("2006-01-02"),
 		},
 	})
@@ -24,9 +24,18 @@ func NewLoggerHandler() Interface {
 	return &loggerHandler{}
 }
 
-func (l *loggerHandler) List(arg DepositoryCond) ([]models.Depository, int64, error) {
-	return nil, 0, nil
+func (l *loggerHandler) List(arg DepositoryCond) (Page, error) {
+	return Page{}, nil
 }
+
+func (l *loggerHandler) Stats(arg DepositoryCond, opts StatsOptions) ([]StatsBucket, error) {
+	return []StatsBucket{}, nil
+}
+
+func (l *loggerHandler) Export(arg DepositoryCond, fn func(d *models.Depository) error) error {
+	return nil
+}
+
 func (l *loggerHandler) Get(arg DepositoryCond) (models.Depository, error) {
 	return models.Depository{}, nil
 }
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/sqlite"
+	"github.com/bestchains/bc-saas/pkg/tsa"
+)
+
+type sqliteHandler struct {
+	certificates
+
+	store *sqlite.Store
+}
+
+// NewSQLiteHandler serves depositories indexed in an embedded SQLite database
+func NewSQLiteHandler(store *sqlite.Store, templateBaseImages map[Style]string, ttpfFontPath string, tsaClient *tsa.Client) (Interface, error) {
+	c, err := newCertificates(templateBaseImages, ttpfFontPath, tsaClient)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteHandler{store: store, certificates: c}, nil
+}
+
+func (h *sqliteHandler) List(arg DepositoryCond) (Page, error) {
+	cond, params := h.filter(arg)
+	// planner estimates are not available, so depositories are counted exactly
+	count := int64(-1)
+	if arg.Count != CountNone {
+		var err error
+		if count, err = h.store.CountDepositories(cond, params); err != nil {
+			return Page{}, err
+		}
+	}
+	order, from, size := `"trustedTimestamp" desc, kid desc`, arg.From, arg.Size
+	if len(arg.Sort) > 0 {
+		order = orderBy(arg.Sort)
+	} else if arg.Cursor != nil {
+		var cursorCond string
+		var cursorParams []interface{}
+		cursorCond, cursorParams, order = arg.Cursor.cond()
+		cond = append(cond, cursorCond)
+		params = append(params, cursorParams...)
+		from = 0
+	}
+	if size != 0 {
+		// one more to tell whether there is a next page
+		size++
+	}
+	result, err := h.store.ListDepositories(cond, params, order, from, size)
+	if err != nil {
+		return Page{}, err
+	}
+	for i := range result {
+		highlight(&result[i], arg.Q)
+	}
+	return newPage(result, count, arg), nil
+}
+
+// filter returns conditions of depositories matching arg
+func (h *sqliteHandler) filter(arg DepositoryCond) ([]string, []interface{}) {
+	cond, params := arg.ToCond()
+	// no full-text index in sqlite. Every word is matched as a substring instead
+	for _, word := range models.SearchWords(arg.Q) {
+		cond = append(cond, `(lower(name) like ? or lower("contentName") like ? or lower(description) like ?)`)
+		pattern := fmt.Sprintf(`%%%s%%`, word)
+		params = append(params, pattern, pattern, pattern)
+	}
+	switch {
+	case arg.Accounts == nil:
+	case len(arg.Accounts) == 0:
+		cond = append(cond, "0")
+	default:
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(arg.Accounts)), ",")
+		cond = append(cond, fmt.Sprintf(`(owner IN (%s) OR operator IN (%s))`, placeholders, placeholders))
+		// once for owner and once for operator
+		for i := 0; i < 2; i++ {
+			for _, account := range arg.Accounts {
+				params = append(params, account)
+			}
+		}
+	}
+	klog.V(5).Infof(" sqliteHandler query %v %v\n", cond, params)
+	return cond, params
+}
+
+func (h *sqliteHandler) Stats(arg DepositoryCond, opts StatsOptions) ([]StatsBucket, error) {
+	cond, params := h.filter(arg)
+	column, limit := "", 0
+	switch {
+	case opts.Group.IsTime():
+		// sqlite has no time zones. Depositories are counted by second and bucketed here
+		column = `"trustedTimestamp"`
+	case opts.Group.IsBreakdown():
+		column, limit = groupColumns[opts.Group], opts.Limit
+	}
+	aggregates, err := h.store.AggregateDepositories(cond, params, column, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]StatsBucket, 0, len(aggregates))
+	for _, a := range aggregates {
+		result = append(result, StatsBucket{Key: a.Key, Count: a.Count, ContentSize: a.ContentSize})
+	}
+	if opts.Group.IsTime() {
+		loc := opts.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		return bucketByTime(result, opts.Group, loc)
+	}
+	return result, nil
+}
+
+func (h *sqliteHandler) Export(arg DepositoryCond, fn func(d *models.Depository) error) error {
+	cond, params := h.filter(arg)
+	order := `"trustedTimestamp" desc, kid desc`
+	if len(arg.Sort) > 0 {
+		order = orderBy(arg.Sort)
+	}
+	return h.store.EachDepository(cond, params, order, fn)
+}
+
+func (h *sqliteHandler) Get(arg DepositoryCond) (models.Depository, error) {
+	cond, params := arg.ToCond()
+	result, err := h.store.GetDepository(cond, params)
+	if err != nil {
+		// handlers report pg.ErrNoRows as not found whatever the storage is
+		if err == sql.ErrNoRows {
+			err = pg.ErrNoRows
+		}
+		return result, err
+	}
+	h.verifyTimestampToken(&result)
+	return result, nil
+}
+
+func (h *sqliteHandler) GetCertificate(arg DepositoryCond, style Style) ([]byte, error) {
+	return h.render(style, func() (models.Depository, error) {
+		return h.Get(arg)
+	})
+}
@@ -26,6 +26,28 @@ type DepositoryCond struct {
 	From, Size             int
 	Name, KID, ContentName string
 	StartTime, EndTime     int64
+
+	// exact matches
+	Owner, Operator, Platform, ContentType, ContentID, TransactionID string
+	// inclusive ranges. Not limited if nil
+	MinBlockNumber, MaxBlockNumber *uint64
+	MinContentSize, MaxContentSize *int64
+
+	// Sort overrides the default order, newest first. Not supported with Cursor
+	Sort []SortField
+	// Q searches name, contentName and description, and results are ranked by relevance.
+	// It is not a part of ToCond, as each storage searches in its own way.
+	Q string
+	// Cursor lists depositories after it instead of from. Not supported with Q
+	Cursor *Cursor
+	// Count is how matching depositories are counted. Default is CountExact
+	Count CountMode
+	// Accounts selects depositories owned or operated by any of them. Nothing is selected if it is empty
+	// but not nil. It is not a part of ToCond, as it has a varying number of params.
+	Accounts []string
+	// IncludeHidden also selects depositories hidden by moderation, which are only served to admins.
+	// Moderation is only supported by postgreSQL.
+	IncludeHidden bool
 }
 
 func (dc *DepositoryCond) ToCond() ([]string, []interface{}) {
@@ -53,11 +75,49 @@ func (dc *DepositoryCond) ToCond() ([]string, []interface{}) {
 		cond = append(cond, `"name" like ?`)
 		params = append(params, fmt.Sprintf(`%%%s%%`, dc.Name))
 	}
+
+	for _, eq := range []struct {
+		column, value string
+	}{
+		{"owner", dc.Owner},
+		{"operator", dc.Operator},
+		{"platform", dc.Platform},
+		{`"contentType"`, dc.ContentType},
+		{`"contentID"`, dc.ContentID},
+		{`"transactionID"`, dc.TransactionID},
+	} {
+		if eq.value != "" {
+			cond = append(cond, eq.column+"=?")
+			params = append(params, eq.value)
+		}
+	}
+	if dc.MinBlockNumber != nil {
+		cond = append(cond, `"blockNumber">=?`)
+		params = append(params, *dc.MinBlockNumber)
+	}
+	if dc.MaxBlockNumber != nil {
+		cond = append(cond, `"blockNumber"<=?`)
+		params = append(params, *dc.MaxBlockNumber)
+	}
+	if dc.MinContentSize != nil {
+		cond = append(cond, `"contentSize">=?`)
+		params = append(params, *dc.MinContentSize)
+	}
+	if dc.MaxContentSize != nil {
+		cond = append(cond, `"contentSize"<=?`)
+		params = append(params, *dc.MaxContentSize)
+	}
 	return cond, params
 }
 
 type Interface interface {
 	Get(DepositoryCond) (models.Depository, error)
+	// GetCertificate returns ErrDisputed if the depository is disputed
 	GetCertificate(cond DepositoryCond, style Style) ([]byte, error)
-	List(DepositoryCond) ([]models.Depository, int64, error)
+	List(DepositoryCond) (Page, error)
+	// Stats aggregates depositories matching a condition. Pagination of the condition is ignored
+	Stats(DepositoryCond, StatsOptions) ([]StatsBucket, error)
+	// Export calls fn with each depository matching a condition in order without loading all of them.
+	// Pagination of the condition is ignored.
+	Export(arg DepositoryCond, fn func(d *models.Depository) error) error
 }
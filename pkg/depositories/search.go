@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+const (
+	// snippetSize is the max number of characters in a highlighted description
+	snippetSize = 80
+	// snippetLead is the number of characters kept before the first match in a snippet
+	snippetLead = 20
+)
+
+// highlight sets highlights of depository d with words of query q emphasized by <em>.
+// Text is html escaped. Long descriptions are cut into a snippet around the first match.
+func highlight(d *models.Depository, q string) {
+	words := models.SearchWords(q)
+	if len(words) == 0 {
+		return
+	}
+	for _, field := range []struct {
+		name    string
+		text    string
+		snippet bool
+	}{{"name", d.Name, false}, {"contentName", d.ContentName, false}, {"description", d.Description, true}} {
+		if highlighted, ok := emphasize(field.text, words, field.snippet); ok {
+			if d.Highlights == nil {
+				d.Highlights = make(map[string]string)
+			}
+			d.Highlights[field.name] = highlighted
+		}
+	}
+}
+
+// emphasize wraps case-insensitive matches of words in text, and reports whether any matches
+func emphasize(text string, words []string, snippet bool) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	matched := make([]bool, len(runes))
+	first := -1
+	for _, word := range words {
+		w := []rune(word)
+		for i := 0; i+len(w) <= len(lower); i++ {
+			if string(lower[i:i+len(w)]) != word {
+				continue
+			}
+			for j := i; j < i+len(w); j++ {
+				matched[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	start, end := 0, len(runes)
+	if snippet && len(runes) > snippetSize {
+		start = first - snippetLead
+		if start < 0 {
+			start = 0
+		}
+		end = start + snippetSize
+		if end > len(runes) {
+			end = len(runes)
+			start = end - snippetSize
+		}
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && matched[j] == matched[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if matched[i] {
+			segment = "<em>" + segment + "</em>"
+		}
+		b.WriteString(segment)
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
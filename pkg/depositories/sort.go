@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sortColumns are fields depositories can be sorted by, and their columns
+var sortColumns = map[string]string{
+	"trustedTimestamp": `"trustedTimestamp"`,
+	"blockNumber":      `"blockNumber"`,
+	"contentSize":      `"contentSize"`,
+	"ingestedAt":       `"ingestedAt"`,
+	"name":             `name`,
+	"contentName":      `"contentName"`,
+	"owner":            `owner`,
+	"operator":         `operator`,
+	"platform":         `platform`,
+	"kid":              `kid`,
+}
+
+// SortField sorts depositories by Field
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses comma separated fields, each prefixed with - for descending order,
+// such as -blockNumber,name
+func ParseSort(s string) ([]SortField, error) {
+	if s == "" {
+		return nil, nil
+	}
+	fields := make([]SortField, 0)
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		field := SortField{Field: f}
+		if strings.HasPrefix(f, "-") {
+			field = SortField{Field: f[1:], Desc: true}
+		}
+		if _, ok := sortColumns[field.Field]; !ok {
+			return nil, fmt.Errorf("invalid sort field %q", field.Field)
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("duplicate sort field %q", field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// orderBy returns the order of fields. kid is appended to break ties, so pages are stable.
+func orderBy(fields []SortField) string {
+	order := make([]string, 0, len(fields)+1)
+	hasKID := false
+	for _, f := range fields {
+		direction := "asc"
+		if f.Desc {
+			direction = "desc"
+		}
+		order = append(order, sortColumns[f.Field]+" "+direction)
+		hasKID = hasKID || f.Field == "kid"
+	}
+	if !hasKID {
+		order = append(order, "kid asc")
+	}
+	return strings.Join(order, ", ")
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/sqlite"
+)
+
+// TestParseSort tests validating sort fields
+func TestParseSort(t *testing.T) {
+	fields, err := ParseSort("-blockNumber,name")
+	require.NoError(t, err)
+	assert.Equal(t, []SortField{{Field: "blockNumber", Desc: true}, {Field: "name"}}, fields)
+	assert.Equal(t, `"blockNumber" desc, name asc, kid asc`, orderBy(fields))
+
+	_, err = ParseSort("-blocknumber")
+	assert.Error(t, err)
+	_, err = ParseSort("name,-name")
+	assert.Error(t, err)
+	_, err = ParseSort("name,")
+	assert.Error(t, err)
+}
+
+// TestFilterAndSort tests listing depositories with filters and sort fields
+func TestFilterAndSort(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "bc-saas.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.Commit([]*models.Depository{
+		{KID: "kid1", Owner: "alice", Platform: "bestchains", BlockNumber: 10, ContentSize: 100, ContentType: "pdf"},
+		{KID: "kid2", Owner: "alice", Platform: "bestchains", BlockNumber: 20, ContentSize: 300, ContentType: "jpg"},
+		{KID: "kid3", Owner: "bob", Platform: "bestchains", BlockNumber: 30, ContentSize: 200, ContentType: "pdf"},
+	}, models.Checkpoint{Channel: "channel", Contract: "depository"}))
+	h, err := NewSQLiteHandler(store, nil, "", nil)
+	require.NoError(t, err)
+
+	minBlock, maxSize := uint64(15), int64(250)
+	page, err := h.List(DepositoryCond{Size: 10, Platform: "bestchains", MinBlockNumber: &minBlock, MaxContentSize: &maxSize})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid3"}, kids(page))
+
+	page, err = h.List(DepositoryCond{Size: 10, Owner: "alice", Sort: []SortField{{Field: "contentSize", Desc: true}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid2", "kid1"}, kids(page))
+	assert.Nil(t, page.Next)
+
+	page, err = h.List(DepositoryCond{Size: 1, ContentType: "pdf", Sort: []SortField{{Field: "owner", Desc: true}, {Field: "blockNumber"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid3"}, kids(page))
+	assert.Equal(t, int64(2), page.Count)
+
+}
+
+// TestListAccounts tests listing depositories owned or operated by accounts
+func TestListAccounts(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "bc-saas.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.Commit([]*models.Depository{
+		{KID: "kid1", Owner: "alice", BlockNumber: 10},
+		{KID: "kid2", Owner: "alice", BlockNumber: 20},
+		{KID: "kid3", Owner: "bob", Operator: "carol", BlockNumber: 30},
+		{KID: "kid4", Owner: "bob", BlockNumber: 40},
+	}, models.Checkpoint{Channel: "channel", Contract: "depository"}))
+	h, err := NewSQLiteHandler(store, nil, "", nil)
+	require.NoError(t, err)
+
+	page, err := h.List(DepositoryCond{Size: 10, Accounts: []string{"carol", "alice"}, Sort: []SortField{{Field: "blockNumber"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kid1", "kid2", "kid3"}, kids(page))
+
+	// filters apply to depositories of accounts
+	page, err = h.List(DepositoryCond{Size: 10, Accounts: []string{"carol"}, Owner: "alice"})
+	require.NoError(t, err)
+	assert.Empty(t, kids(page))
+
+	// no account, no depository
+	page, err = h.List(DepositoryCond{Size: 10, Accounts: []string{}})
+	require.NoError(t, err)
+	assert.Empty(t, kids(page))
+	assert.Equal(t, int64(0), page.Count)
+}
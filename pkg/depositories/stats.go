@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Group of depository statistics
+type Group string
+
+const (
+	// GroupNone aggregates all depositories into one bucket
+	GroupNone Group = ""
+	// buckets of trustedTimestamp
+	GroupDay   Group = "day"
+	GroupWeek  Group = "week"
+	GroupMonth Group = "month"
+	// breakdowns
+	GroupOwner       Group = "owner"
+	GroupPlatform    Group = "platform"
+	GroupContentType Group = "contentType"
+)
+
+// groupColumns are columns of breakdowns
+var groupColumns = map[Group]string{
+	GroupOwner:       `owner`,
+	GroupPlatform:    `platform`,
+	GroupContentType: `"contentType"`,
+}
+
+// IsTime reports whether g buckets by time
+func (g Group) IsTime() bool {
+	return g == GroupDay || g == GroupWeek || g == GroupMonth
+}
+
+// IsBreakdown reports whether g breaks down by a field
+func (g Group) IsBreakdown() bool {
+	_, ok := groupColumns[g]
+	return ok
+}
+
+// StatsOptions defines how depositories are aggregated
+type StatsOptions struct {
+	Group Group
+	// Limit is the max number of buckets of a breakdown, which are the top ones by count
+	Limit int
+	// Location of time buckets. Default is UTC
+	Location *time.Location
+}
+
+// StatsBucket is the number and total content size of depositories in a bucket
+type StatsBucket struct {
+	// Key of bucket, such as 2023-04-25 for a day or owner of a breakdown
+	Key string `json:"key,omitempty"`
+	// Start time of a time bucket
+	Start       int64 `json:"start,omitempty"`
+	Count       int64 `json:"count"`
+	ContentSize int64 `json:"contentSize"`
+}
+
+// bucketStart returns the start of the time bucket of g which t is in
+func bucketStart(t time.Time, g Group) time.Time {
+	y, m, d := t.Date()
+	switch g {
+	case GroupWeek:
+		// weeks start on monday
+		d -= (int(t.Weekday()) + 6) % 7
+	case GroupMonth:
+		d = 1
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// timeBucket returns the bucket of g starting at start
+func timeBucket(start time.Time, g Group) StatsBucket {
+	key := start.Format("2006-01-02")
+	if g == GroupMonth {
+		key = start.Format("2006-01")
+	}
+	return StatsBucket{Key: key, Start: start.Unix()}
+}
+
+// bucketByTime folds counts of trusted timestamps into time buckets of g in order
+func bucketByTime(counts []StatsBucket, g Group, loc *time.Location) ([]StatsBucket, error) {
+	buckets := make(map[int64]*StatsBucket)
+	for _, c := range counts {
+		var ts int64
+		if _, err := fmt.Sscan(c.Key, &ts); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %s", c.Key)
+		}
+		start := bucketStart(time.Unix(ts, 0).In(loc), g)
+		b, ok := buckets[start.Unix()]
+		if !ok {
+			bucket := timeBucket(start, g)
+			b = &bucket
+			buckets[start.Unix()] = b
+		}
+		b.Count += c.Count
+		b.ContentSize += c.ContentSize
+	}
+	result := make([]StatsBucket, 0, len(buckets))
+	for _, b := range buckets {
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Start < result[j].Start })
+	return result, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package depositories
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/sqlite"
+)
+
+// TestStats tests aggregating depositories by time and fields
+func TestStats(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "bc-saas.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	// 2023-04-24 is a monday. 16:30 UTC is on the next day in Asia/Shanghai
+	day := time.Date(2023, 4, 24, 0, 0, 0, 0, time.UTC).Unix()
+	require.NoError(t, store.Commit([]*models.Depository{
+		{KID: "kid1", Owner: "alice", TrustedTimestamp: day + 3600, ContentSize: 10},
+		{KID: "kid2", Owner: "alice", TrustedTimestamp: day + 16*3600 + 1800, ContentSize: 20},
+		{KID: "kid3", Owner: "bob", TrustedTimestamp: day + 8*24*3600, ContentSize: 30},
+	}, models.Checkpoint{Channel: "channel", Contract: "depository"}))
+	h, err := NewSQLiteHandler(store, nil, "", nil)
+	require.NoError(t, err)
+
+	buckets, err := h.Stats(DepositoryCond{}, StatsOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []StatsBucket{{Count: 3, ContentSize: 60}}, buckets)
+
+	buckets, err = h.Stats(DepositoryCond{}, StatsOptions{Group: GroupDay})
+	require.NoError(t, err)
+	assert.Equal(t, []StatsBucket{
+		{Key: "2023-04-24", Start: day, Count: 2, ContentSize: 30},
+		{Key: "2023-05-02", Start: day + 8*24*3600, Count: 1, ContentSize: 30},
+	}, buckets)
+
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	buckets, err = h.Stats(DepositoryCond{Owner: "alice"}, StatsOptions{Group: GroupDay, Location: shanghai})
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, "2023-04-25", buckets[1].Key)
+
+	buckets, err = h.Stats(DepositoryCond{}, StatsOptions{Group: GroupWeek})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2023-04-24", "2023-05-01"}, []string{buckets[0].Key, buckets[1].Key})
+	buckets, err = h.Stats(DepositoryCond{}, StatsOptions{Group: GroupMonth})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2023-04", "2023-05"}, []string{buckets[0].Key, buckets[1].Key})
+
+	buckets, err = h.Stats(DepositoryCond{}, StatsOptions{Group: GroupOwner, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []StatsBucket{{Key: "alice", Count: 2, ContentSize: 30}}, buckets)
+}
@@ -17,12 +17,14 @@ limitations under the License.
 package events
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
@@ -30,6 +32,8 @@ import (
 	"github.com/bestchains/bc-saas/pkg/contracts"
 	handler "github.com/bestchains/bc-saas/pkg/handlers"
 	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/tsa"
+	"github.com/bestchains/bc-saas/pkg/utils"
 )
 
 const (
@@ -42,49 +46,132 @@ type kv struct {
 	KID      string `json:"kid,omitempty"`
 	Operator string `json:"operator"`
 	Owner    string `json:"owner"`
+	// Value is included by newer contracts
+	Value string `json:"value,omitempty"`
 }
 
 type DepositoryEventHandler struct {
 	contractClient *contracts.Depository
-	db             *pg.DB
+	// qscc to get transactions from ledger
+	qscc *contracts.QSCC
+	// tsaClient requests timestamp tokens for depositories. Optional
+	tsaClient *tsa.Client
+	db        *pg.DB
+	// crossCheck compares values decoded from transactions with ledger state
+	crossCheck bool
+	// notifiers of indexed depositories
+	notifiers []Notifier
 }
 
-func NewDepositoryEventHandler(contractClient *contracts.Depository, db *pg.DB) *DepositoryEventHandler {
+func NewDepositoryEventHandler(contractClient *contracts.Depository, qscc *contracts.QSCC, tsaClient *tsa.Client, db *pg.DB, crossCheck bool, notifiers ...Notifier) *DepositoryEventHandler {
 	return &DepositoryEventHandler{
 		contractClient: contractClient,
+		qscc:           qscc,
+		tsaClient:      tsaClient,
 		db:             db,
+		crossCheck:     crossCheck,
+		notifiers:      notifiers,
 	}
 }
 
 // HandlePutValue handle events
 // - EventPutValue
 // - EventPutUntrustValue
-func (deh *DepositoryEventHandler) HandlePutValue(e *client.ChaincodeEvent) error {
+func (deh *DepositoryEventHandler) HandlePutValue(e *client.ChaincodeEvent) (Commit, error) {
+	d, err := deh.Prepare(e)
+	if err != nil {
+		return nil, err
+	}
+	return deh.commit(d), nil
+}
+
+// Prepare returns the depository created by event e without storing it
+func (deh *DepositoryEventHandler) Prepare(e *client.ChaincodeEvent) (*models.Depository, error) {
+	processedTx, err := deh.qscc.GetTransactionByID(e.TransactionID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get transaction %s", e.TransactionID)
+	}
+	tx, err := utils.ParseChaincodeTransaction(processedTx.GetTransactionEnvelope())
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse transaction %s", e.TransactionID)
+	}
+	return deh.prepareTransaction(e, tx)
+}
+
+// handleTransaction indexes the depository created by event e in transaction tx
+func (deh *DepositoryEventHandler) handleTransaction(e *client.ChaincodeEvent, tx *utils.ChaincodeTransaction) (Commit, error) {
+	d, err := deh.prepareTransaction(e, tx)
+	if err != nil {
+		return nil, err
+	}
+	return deh.commit(d), nil
+}
+
+// prepareTransaction returns the depository created by event e in transaction tx with its timestamp token
+func (deh *DepositoryEventHandler) prepareTransaction(e *client.ChaincodeEvent, tx *utils.ChaincodeTransaction) (*models.Depository, error) {
 	eventPayload := kv{}
 	if err := json.Unmarshal(e.Payload, &eventPayload); err != nil {
-		return errors.Wrap(err, "unmarshal event payload")
+		return nil, errors.Wrap(err, "unmarshal event payload")
 	}
 	klog.V(5).Infof("[Debug] event payload %+v", eventPayload)
 
-	what, err := deh.contractClient.GetValueByKID(eventPayload.KID)
+	d, err := deh.depository(e, eventPayload, tx)
 	if err != nil {
-		return errors.Wrapf(err, "getValue By KID %s", eventPayload.KID)
+		return nil, err
+	}
+	// attest content hash by an independent timestamp authority
+	if deh.tsaClient != nil {
+		ts, err := deh.tsaClient.Stamp([]byte(d.ContentID))
+		if err != nil {
+			// depository is still indexed without a token
+			klog.Errorf("[Error] request timestamp token for depository %s: %s", d.KID, err)
+		} else {
+			d.TimestampToken = ts.RawToken
+			d.TimestampTokenTime = ts.Time.Unix()
+		}
 	}
+	return d, nil
+}
 
-	klog.V(5).Infof("[Debug] Call GetValueByKID %s get %s", eventPayload.KID, what)
+// commit inserts d and notifies notifiers
+func (deh *DepositoryEventHandler) commit(d *models.Depository) Commit {
+	return func(db orm.DB) error {
+		klog.V(5).Infof("[Debug] insert d: %+v into db", d)
+		d.SearchVector = models.SearchVector(d)
+		// depository may have been indexed before checkpoints were introduced
+		result, err := db.Model(d).OnConflict("(kid) DO NOTHING").Insert()
+		if err != nil {
+			return errors.Wrap(err, "insert depository data")
+		}
+		if result.RowsAffected() == 0 {
+			klog.Infof("depository %s at block %d already exists, skip", d.KID, d.BlockNumber)
+			return nil
+		}
+		for _, notifier := range deh.notifiers {
+			if err := notifier.DepositoryCreated(db, d); err != nil {
+				return errors.Wrapf(err, "notify depository %s", d.KID)
+			}
+		}
+		klog.Infof("[Success] insert depository %s at block %d to db", d.KID, d.BlockNumber)
+		return nil
+	}
+}
 
-	vdBytes, err := base64.StdEncoding.DecodeString(what)
-	if err != nil {
-		return errors.Wrap(err, "decode value")
+// depository builds the depository created by event e in transaction tx
+func (deh *DepositoryEventHandler) depository(e *client.ChaincodeEvent, eventPayload kv, tx *utils.ChaincodeTransaction) (*models.Depository, error) {
+	// trusted timestamp must be the time when this transaction happened on ledger
+	if tx.ChannelHeader.GetTimestamp() == nil {
+		return nil, errors.Errorf("transaction %s has no timestamp", e.TransactionID)
 	}
-	klog.V(5).Infof("[Debug] value depository bytes: %s", string(vdBytes))
+	trustedTimestamp := tx.ChannelHeader.GetTimestamp().GetSeconds()
 
-	vd := handler.ValueDepository{}
-	if err := json.Unmarshal(vdBytes, &vd); err != nil {
-		return errors.Wrap(err, "unmarshal valueDepository")
+	what, vd, err := deh.value(e, eventPayload, tx)
+	if err != nil {
+		return nil, err
 	}
+	klog.V(5).Infof("[Debug] value depository: %s", what)
 
-	d := models.Depository{
+	return &models.Depository{
 		Index:            fmt.Sprintf("%d", eventPayload.Index),
 		KID:              eventPayload.KID,
 		Platform:         vd.Platform,
@@ -96,15 +183,89 @@ func (deh *DepositoryEventHandler) HandlePutValue(e *client.ChaincodeEvent) erro
 		ContentName:      vd.ContentName,
 		ContentID:        vd.ContentID,
 		ContentType:      vd.ContentType,
-		TrustedTimestamp: time.Now().Unix(),
+		TrustedTimestamp: trustedTimestamp,
 		Description:      vd.Description,
 		ContentSize:      vd.ContentSize,
+		IngestedAt:       time.Now().Unix(),
+	}, nil
+}
+
+// value returns the depository value written by transaction tx. It is looked up in order:
+// - the event payload, if the contract includes it
+// - the write set of tx
+// - ledger state by GetValueByKID, which may differ from the state at tx
+func (deh *DepositoryEventHandler) value(e *client.ChaincodeEvent, eventPayload kv, tx *utils.ChaincodeTransaction) (string, *handler.ValueDepository, error) {
+	source := "event payload"
+	what := eventPayload.Value
+	vd, err := decodeValue(what)
+	if err != nil {
+		source = "write set"
+		what, vd, err = valueFromWrites(tx, e.ChaincodeName, eventPayload.KID)
 	}
-	klog.V(5).Infof("[Debug] insert vd %+v, d: %+v into db", vd, d)
+	if err != nil {
+		source = "ledger state"
+		what, err = deh.contractClient.GetValueByKID(eventPayload.KID)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "getValue By KID %s", eventPayload.KID)
+		}
+		if vd, err = decodeValue(what); err != nil {
+			return "", nil, err
+		}
+		klog.V(5).Infof("[Debug] Call GetValueByKID %s get %s", eventPayload.KID, what)
+	}
+	klog.V(5).Infof("[Debug] value of depository %s from %s", eventPayload.KID, source)
+
+	if deh.crossCheck && source != "ledger state" {
+		state, err := deh.contractClient.GetValueByKID(eventPayload.KID)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "getValue By KID %s", eventPayload.KID)
+		}
+		if state != what {
+			klog.Warningf("value of depository %s from %s mismatches ledger state", eventPayload.KID, source)
+		}
+	}
+	return what, vd, nil
+}
 
-	if _, err := deh.db.Model(&d).Insert(); err != nil {
-		return errors.Wrap(err, "insert depository data")
+// valueFromWrites finds the depository value in writes of contract. The value is either
+// written under the key of kid, or written as is from an argument of invocation.
+func valueFromWrites(tx *utils.ChaincodeTransaction, contract string, kid string) (string, *handler.ValueDepository, error) {
+	writes := tx.Writes[contract]
+	candidates := make([][]byte, 0, len(writes))
+	for _, w := range writes {
+		if !w.GetIsDelete() && utils.IsKeyOf(w.GetKey(), kid) {
+			candidates = append(candidates, w.GetValue())
+		}
+	}
+	if len(tx.Args) > 1 {
+		for _, w := range writes {
+			for _, arg := range tx.Args[1:] {
+				if !w.GetIsDelete() && bytes.Equal(w.GetValue(), arg) {
+					candidates = append(candidates, w.GetValue())
+				}
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if vd, err := decodeValue(string(candidate)); err == nil {
+			return string(candidate), vd, nil
+		}
+	}
+	return "", nil, errors.Errorf("value of depository %s not found in write set", kid)
+}
+
+// decodeValue decodes a base64 encoded handler.ValueDepository
+func decodeValue(what string) (*handler.ValueDepository, error) {
+	if what == "" {
+		return nil, errors.New("empty value")
+	}
+	vdBytes, err := base64.StdEncoding.DecodeString(what)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode value")
+	}
+	vd := &handler.ValueDepository{}
+	if err := json.Unmarshal(vdBytes, vd); err != nil {
+		return nil, errors.Wrap(err, "unmarshal valueDepository")
 	}
-	klog.Infof("[Success] insert depository %s at block %d to db", d.KID, d.BlockNumber)
-	return nil
+	return vd, nil
 }
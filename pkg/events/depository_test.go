@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bestchains/bc-saas/pkg/utils"
+)
+
+// TestValueFromWrites tests finding depository values in write sets
+func TestValueFromWrites(t *testing.T) {
+	value := base64.StdEncoding.EncodeToString([]byte(`{"name":"dep1","contentID":"hash"}`))
+	other := base64.StdEncoding.EncodeToString([]byte(`{"name":"dep2","contentID":"hash2"}`))
+
+	// written under a composite key of kid
+	tx := &utils.ChaincodeTransaction{
+		Args: [][]byte{[]byte("PutUntrustValue"), []byte(other)},
+		Writes: map[string][]*kvrwset.KVWrite{
+			"depository": {
+				{Key: "\x00counter\x00", Value: []byte("26")},
+				{Key: "\x00kid\x00kid1\x00", Value: []byte(value)},
+			},
+		},
+	}
+	what, vd, err := valueFromWrites(tx, "depository", "kid1")
+	assert.NoError(t, err)
+	assert.Equal(t, value, what)
+	assert.Equal(t, "dep1", vd.Name)
+
+	// written as is from argument
+	tx.Writes["depository"][1].Key = "index26"
+	tx.Args[1] = []byte(value)
+	what, _, err = valueFromWrites(tx, "depository", "kid1")
+	assert.NoError(t, err)
+	assert.Equal(t, value, what)
+
+	// keys which merely end with kid are ignored
+	tx.Writes["depository"][1].Key = "\x00kid\x00xkid1\x00"
+	tx.Args[1] = []byte(other)
+	_, _, err = valueFromWrites(tx, "depository", "kid1")
+	assert.Error(t, err)
+	tx.Writes["depository"][1].Key = "\x00kid\x00kid1\x00"
+
+	// other contracts and deleted keys are ignored
+	_, _, err = valueFromWrites(tx, "market", "kid1")
+	assert.Error(t, err)
+	tx.Writes["depository"][1].IsDelete = true
+	_, _, err = valueFromWrites(tx, "depository", "kid1")
+	assert.Error(t, err)
+}
@@ -16,8 +16,24 @@ limitations under the License.
 
 package events
 
-import "github.com/hyperledger/fabric-gateway/pkg/client"
+import (
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
 
 type Event string
 
-type EventHandler func(event *client.ChaincodeEvent) error
+// EventHandler prepares an event. It does the slow part of handling, such as ledger queries,
+// and runs concurrently with other events. The returned Commit runs in order of events.
+type EventHandler func(event *client.ChaincodeEvent) (Commit, error)
+
+// Commit stores results of a prepared event with db, which is
+// the transaction that also saves the checkpoint of event
+type Commit func(db orm.DB) error
+
+// Notifier is notified of indexed depositories with db, which is the transaction that inserts them
+type Notifier interface {
+	DepositoryCreated(db orm.DB, depository *models.Depository) error
+}
@@ -0,0 +1,465 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/utils"
+)
+
+const (
+	// at most reconcileMaxMissing missing indexes or transactions are listed and repaired in a run
+	reconcileMaxMissing = 1000
+	// blocks scanned to repair a missing index
+	reconcileMaxScanBlocks = 10000
+	// pages of depositories are sampled for reconcileOversample times of sampled depositories,
+	// as sampled pages may hold fewer rows than expected
+	reconcileOversample = 4
+)
+
+var (
+	reconcileLedgerTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "reconcile",
+		Name:      "ledger_depositories",
+		Help:      "Number of depositories on ledger",
+	})
+	reconcileIndexed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "reconcile",
+		Name:      "indexed_depositories",
+		Help:      "Number of indexed depositories",
+	})
+	reconcileMissing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "reconcile",
+		Name:      "missing",
+		Help:      "Number of depositories missing in index by kind(index or transaction)",
+	}, []string{"kind"})
+	reconcileMismatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "reconcile",
+		Name:      "mismatches",
+		Help:      "Number of sampled depositories whose fields differ from ledger state",
+	})
+	reconcileRepaired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "bc_saas",
+		Subsystem: "reconcile",
+		Name:      "repaired_total",
+		Help:      "Number of depositories repaired by reconciliation",
+	})
+	reconcileLastRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "reconcile",
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Time when the last reconciliation finished",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(reconcileLedgerTotal, reconcileIndexed, reconcileMissing, reconcileMismatches, reconcileRepaired, reconcileLastRun)
+}
+
+// ReconcilerConfig configures periodic reconciliation
+type ReconcilerConfig struct {
+	// Interval between reconciliations. Disabled if 0
+	Interval time.Duration
+	// Sample is the number of indexed depositories compared with ledger state
+	Sample int
+	// Repair missing depositories automatically
+	Repair bool
+}
+
+// Reconciler compares the depository index with ledger
+type Reconciler struct {
+	deh      *DepositoryEventHandler
+	contract string
+	config   ReconcilerConfig
+
+	// one reconciliation at a time
+	running sync.Mutex
+
+	mu     sync.RWMutex
+	report *models.ReconcileReport
+	// indexBase is the index of the first depository, 0 or 1
+	indexBase *uint64
+}
+
+func NewReconciler(deh *DepositoryEventHandler, contract string, config ReconcilerConfig) *Reconciler {
+	return &Reconciler{
+		deh:      deh,
+		contract: contract,
+		config:   config,
+	}
+}
+
+// Report returns the report of the last reconciliation
+func (r *Reconciler) Report() (models.ReconcileReport, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.report == nil {
+		return models.ReconcileReport{}, false
+	}
+	return *r.report, true
+}
+
+// Run reconciles periodically until ctx is done
+func (r *Reconciler) Run(ctx context.Context) {
+	if r.config.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reconcile(ctx, r.config.Repair); err != nil {
+				klog.Errorf("[Error] reconcile depositories error %s", err)
+			}
+		}
+	}
+}
+
+// Reconcile compares the index with ledger now. Missing depositories are indexed if repair is true.
+func (r *Reconciler) Reconcile(ctx context.Context, repair bool) (models.ReconcileReport, error) {
+	r.running.Lock()
+	defer r.running.Unlock()
+
+	report := &models.ReconcileReport{
+		StartedAt:           time.Now().Unix(),
+		MissingIndexes:      make([]uint64, 0),
+		MissingTransactions: make([]string, 0),
+		Mismatches:          make([]models.ReconcileMismatch, 0),
+		Errors:              make([]string, 0),
+	}
+	if err := r.count(ctx, report); err != nil {
+		return *report, err
+	}
+	if err := r.missingIndexes(ctx, report); err != nil {
+		return *report, err
+	}
+	if err := r.missingTransactions(ctx, report); err != nil {
+		return *report, err
+	}
+	if err := r.sample(ctx, report); err != nil {
+		return *report, err
+	}
+	if repair {
+		r.repairTransactions(ctx, report)
+		r.repairIndexes(ctx, report)
+		if report.Repaired > 0 {
+			if err := r.count(ctx, report); err != nil {
+				return *report, err
+			}
+		}
+	}
+	report.FinishedAt = time.Now().Unix()
+
+	reconcileLedgerTotal.Set(float64(report.LedgerTotal))
+	reconcileIndexed.Set(float64(report.Indexed))
+	reconcileMissing.WithLabelValues("index").Set(float64(report.MissingIndexesTotal))
+	reconcileMissing.WithLabelValues("transaction").Set(float64(len(report.MissingTransactions)))
+	reconcileMismatches.Set(float64(len(report.Mismatches)))
+	reconcileRepaired.Add(float64(report.Repaired))
+	reconcileLastRun.Set(float64(report.FinishedAt))
+	if report.Drifted() {
+		klog.Warningf("depository index drifted from ledger: %d on ledger, %d indexed, %d indexes missing, %d transactions missing, %d mismatches, %d repaired",
+			report.LedgerTotal, report.Indexed, report.MissingIndexesTotal, len(report.MissingTransactions), len(report.Mismatches), report.Repaired)
+	}
+
+	r.mu.Lock()
+	r.report = report
+	r.mu.Unlock()
+	return *report, nil
+}
+
+func (r *Reconciler) count(ctx context.Context, report *models.ReconcileReport) error {
+	total, err := r.deh.contractClient.Total()
+	if err != nil {
+		return errors.Wrap(err, "get total of depositories")
+	}
+	indexed, err := r.deh.db.ModelContext(ctx, (*models.Depository)(nil)).Count()
+	if err != nil {
+		return errors.Wrap(err, "count depositories")
+	}
+	report.LedgerTotal = total
+	report.Indexed = int64(indexed)
+	return nil
+}
+
+// base returns the index of the first depository, which is probed on ledger
+func (r *Reconciler) base() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.indexBase == nil {
+		base := uint64(1)
+		if _, err := r.deh.contractClient.GetValueByIndex("0"); err == nil {
+			base = 0
+		}
+		r.indexBase = &base
+	}
+	return *r.indexBase
+}
+
+// missingIndexes finds indexes of depositories on ledger which are not indexed
+func (r *Reconciler) missingIndexes(ctx context.Context, report *models.ReconcileReport) error {
+	if report.LedgerTotal == 0 {
+		return nil
+	}
+	base := r.base()
+	last := base + report.LedgerTotal - 1
+	missing := `FROM generate_series(?::bigint, ?::bigint) AS s
+		WHERE NOT EXISTS (SELECT 1 FROM ? AS d WHERE d."index" = s::text)`
+	table := pg.Ident(models.TableName((*models.Depository)(nil)))
+
+	if _, err := r.deh.db.QueryOneContext(ctx, pg.Scan(&report.MissingIndexesTotal), `SELECT count(*) `+missing, base, last, table); err != nil {
+		return errors.Wrap(err, "count missing indexes")
+	}
+	if report.MissingIndexesTotal == 0 {
+		return nil
+	}
+	if _, err := r.deh.db.QueryContext(ctx, &report.MissingIndexes, `SELECT s `+missing+` ORDER BY s LIMIT ?`, base, last, table, reconcileMaxMissing); err != nil {
+		return errors.Wrap(err, "list missing indexes")
+	}
+	return nil
+}
+
+// missingTransactions finds valid depository transactions indexed by the block listener but not in depositories
+func (r *Reconciler) missingTransactions(ctx context.Context, report *models.ReconcileReport) error {
+	txs := make([]models.Transaction, 0)
+	err := r.deh.db.ModelContext(ctx, &txs).
+		Column("transactionID").
+		Where("valid = TRUE").
+		WhereIn("function IN (?)", []string{string(DepositoryEventPutValue), string(DepositoryEventPutUntrustValue)}).
+		Where(`NOT EXISTS (SELECT 1 FROM ? AS d WHERE d."transactionID" = "transaction"."transactionID")`, pg.Ident(models.TableName((*models.Depository)(nil)))).
+		Order("blockNumber ASC").
+		Limit(reconcileMaxMissing).
+		Select()
+	if err != nil {
+		return errors.Wrap(err, "list missing transactions")
+	}
+	for _, tx := range txs {
+		report.MissingTransactions = append(report.MissingTransactions, tx.TransactionID)
+	}
+	return nil
+}
+
+// sample compares fields of random indexed depositories with ledger state
+func (r *Reconciler) sample(ctx context.Context, report *models.ReconcileReport) error {
+	if r.config.Sample <= 0 {
+		return nil
+	}
+	// random pages are read instead of sorting the whole table
+	depositories := make([]models.Depository, 0, r.config.Sample)
+	_, err := r.deh.db.QueryContext(ctx, &depositories, `SELECT * FROM ? TABLESAMPLE SYSTEM (?) LIMIT ?`,
+		pg.Ident(models.TableName((*models.Depository)(nil))), samplePercent(r.config.Sample, report.Indexed), r.config.Sample)
+	if err != nil {
+		return errors.Wrap(err, "sample depositories")
+	}
+	for _, d := range depositories {
+		value, err := r.deh.contractClient.GetValueByKID(d.KID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("get value of %s: %s", d.KID, err))
+			continue
+		}
+		report.Sampled++
+		vd, err := decodeValue(value)
+		if err != nil {
+			report.Mismatches = append(report.Mismatches, models.ReconcileMismatch{KID: d.KID, Fields: []string{"value"}})
+			continue
+		}
+		fields := make([]string, 0)
+		for name, equal := range map[string]bool{
+			"name":        d.Name == vd.Name,
+			"contentName": d.ContentName == vd.ContentName,
+			"contentID":   d.ContentID == vd.ContentID,
+			"contentType": d.ContentType == vd.ContentType,
+			"contentSize": d.ContentSize == vd.ContentSize,
+			"platform":    d.Platform == vd.Platform,
+			"description": d.Description == vd.Description,
+		} {
+			if !equal {
+				fields = append(fields, name)
+			}
+		}
+		if len(fields) > 0 {
+			report.Mismatches = append(report.Mismatches, models.ReconcileMismatch{KID: d.KID, Fields: fields})
+		}
+	}
+	return nil
+}
+
+// samplePercent returns the percentage of pages to sample n of indexed depositories
+func samplePercent(n int, indexed int64) float64 {
+	if indexed <= 0 {
+		return 100
+	}
+	return math.Min(100, float64(n)*reconcileOversample*100/float64(indexed))
+}
+
+// repairTransactions indexes missing transactions
+func (r *Reconciler) repairTransactions(ctx context.Context, report *models.ReconcileReport) {
+	for _, txID := range report.MissingTransactions {
+		if ctx.Err() != nil {
+			return
+		}
+		err := r.repairTransaction(ctx, txID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("repair transaction %s: %s", txID, err))
+			continue
+		}
+		report.Repaired++
+	}
+}
+
+func (r *Reconciler) repairTransaction(ctx context.Context, txID string) error {
+	processedTx, err := r.deh.qscc.GetTransactionByID(txID)
+	if err != nil {
+		return err
+	}
+	tx, err := utils.ParseChaincodeTransaction(processedTx.GetTransactionEnvelope())
+	if err != nil {
+		return err
+	}
+	if tx.Event == nil {
+		return errors.New("no chaincode event in transaction")
+	}
+	// the valid one of transactions with the same id, others are DUPLICATE_TXID
+	var stored models.Transaction
+	if err = r.deh.db.ModelContext(ctx, &stored).Where(`"transactionID" = ?`, txID).Where("valid = TRUE").Limit(1).Select(); err != nil {
+		return err
+	}
+	return r.index(ctx, &contractEvent{
+		ChaincodeEvent: client.ChaincodeEvent{
+			BlockNumber:   stored.BlockNumber,
+			TransactionID: txID,
+			ChaincodeName: tx.ChaincodeName,
+			EventName:     tx.Event.GetEventName(),
+			Payload:       tx.Event.GetPayload(),
+		},
+		tx: tx,
+	})
+}
+
+// repairIndexes scans blocks around each missing index for its event and indexes it
+func (r *Reconciler) repairIndexes(ctx context.Context, report *models.ReconcileReport) {
+	missing := make(map[uint64]bool, len(report.MissingIndexes))
+	for _, index := range report.MissingIndexes {
+		missing[index] = true
+	}
+	scanned := make(map[uint64]bool)
+	for _, index := range report.MissingIndexes {
+		if !missing[index] {
+			continue
+		}
+		lo, hi, err := r.bounds(ctx, index)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("repair index %d: %s", index, err))
+			continue
+		}
+		if hi-lo >= reconcileMaxScanBlocks {
+			report.Errors = append(report.Errors, fmt.Sprintf("repair index %d: too many blocks(%d to %d) to scan, use reindex instead", index, lo, hi))
+			continue
+		}
+		for number := lo; number <= hi && missing[index]; number++ {
+			if ctx.Err() != nil {
+				return
+			}
+			if scanned[number] {
+				continue
+			}
+			scanned[number] = true
+			block, err := r.deh.qscc.GetBlockByNumber(number)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("repair index %d: get block %d: %s", index, number, err))
+				break
+			}
+			for _, e := range contractEvents(block, r.contract) {
+				eventPayload := kv{}
+				if json.Unmarshal(e.Payload, &eventPayload) != nil || !missing[eventPayload.Index] {
+					continue
+				}
+				if err := r.index(ctx, &e); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("repair index %d: %s", eventPayload.Index, err))
+					continue
+				}
+				missing[eventPayload.Index] = false
+				report.Repaired++
+			}
+		}
+	}
+}
+
+// bounds returns the range of blocks where depository index can be, which is between
+// blocks of its indexed neighbours
+func (r *Reconciler) bounds(ctx context.Context, index uint64) (uint64, uint64, error) {
+	table := pg.Ident(models.TableName((*models.Depository)(nil)))
+	var before, after *uint64
+	if _, err := r.deh.db.QueryOneContext(ctx, pg.Scan(&before),
+		`SELECT max("blockNumber") FROM ? WHERE "index"::bigint < ?`, table, index); err != nil {
+		return 0, 0, errors.Wrap(err, "get block of previous index")
+	}
+	if _, err := r.deh.db.QueryOneContext(ctx, pg.Scan(&after),
+		`SELECT min("blockNumber") FROM ? WHERE "index"::bigint > ?`, table, index); err != nil {
+		return 0, 0, errors.Wrap(err, "get block of next index")
+	}
+	var from, to uint64
+	if before != nil {
+		from = *before
+	}
+	if after != nil {
+		to = *after
+	} else {
+		info, err := r.deh.qscc.GetChainInfo()
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "get chain info")
+		}
+		to = info.GetHeight() - 1
+	}
+	if to < from {
+		return 0, 0, errors.Errorf("invalid block range %d to %d", from, to)
+	}
+	return from, to, nil
+}
+
+// index indexes depository of event e in its own transaction
+func (r *Reconciler) index(ctx context.Context, e *contractEvent) error {
+	commit, err := r.deh.handleTransaction(&e.ChaincodeEvent, e.tx)
+	if err != nil {
+		return err
+	}
+	if err = r.deh.db.RunInTransaction(ctx, func(tx *pg.Tx) error { return commit(tx) }); err != nil {
+		return err
+	}
+	klog.Infof("[Success] repair depository in transaction %s", e.TransactionID)
+	return nil
+}
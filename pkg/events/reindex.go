@@ -0,0 +1,465 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/utils"
+)
+
+const (
+	// reindex progress is logged every reindexLogInterval blocks
+	reindexLogInterval = 100
+	// reindexLockName is hashed into the key of the advisory lock of reindex jobs
+	reindexLockName = "reindex"
+)
+
+// Reindexer rebuilds the depository index by replaying blocks from ledger into a fresh
+// table, which is then swapped in as the index. Values by GetValueByIndex are not enough
+// since they don't carry kid, owner and transaction of depositories.
+type Reindexer struct {
+	deh      *DepositoryEventHandler
+	contract string
+
+	mu sync.Mutex
+	// running job of this process and its cancel
+	running int64
+	cancel  context.CancelFunc
+	// conn holds the lock of reindex jobs while running
+	conn *pg.Conn
+}
+
+func NewReindexer(deh *DepositoryEventHandler, contract string) *Reindexer {
+	return &Reindexer{
+		deh:      deh,
+		contract: contract,
+	}
+}
+
+// Start resumes the unfinished reindex job, or starts a new one from fromBlock.
+// The job runs in background.
+func (r *Reindexer) Start(fromBlock uint64) (models.ReindexJob, error) {
+	job, err := r.acquire(fromBlock)
+	if err != nil {
+		return job, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancel = cancel
+	r.mu.Unlock()
+	go func() {
+		defer cancel()
+		if _, err := r.run(ctx, job); err != nil {
+			klog.Errorf("[Error] reindex job %d error %s", job.ID, err)
+		}
+	}()
+	return job, nil
+}
+
+// Run is like Start, but waits until the job finishes
+func (r *Reindexer) Run(ctx context.Context, fromBlock uint64) (models.ReindexJob, error) {
+	job, err := r.acquire(fromBlock)
+	if err != nil {
+		return job, err
+	}
+	return r.run(ctx, job)
+}
+
+func (r *Reindexer) List(from, size int) ([]models.ReindexJob, int64, error) {
+	result := make([]models.ReindexJob, 0)
+	count, err := r.deh.db.Model(&result).Order("id DESC").Offset(from).Limit(size).SelectAndCount()
+	return result, int64(count), err
+}
+
+func (r *Reindexer) Get(id int64) (models.ReindexJob, error) {
+	job := models.ReindexJob{ID: id}
+	err := r.deh.db.Model(&job).WherePK().Select()
+	return job, err
+}
+
+// Cancel stops job id and drops its table
+func (r *Reindexer) Cancel(id int64) (models.ReindexJob, error) {
+	job, err := r.Get(id)
+	if err != nil {
+		return job, err
+	}
+	if job.Status == models.ReindexCompleted || job.Status == models.ReindexCancelled {
+		return job, models.ErrReindexFinished
+	}
+
+	r.mu.Lock()
+	if r.running == id {
+		r.cancel()
+	}
+	r.mu.Unlock()
+
+	if _, err = r.deh.db.Exec(`DROP TABLE IF EXISTS ?`, pg.Ident(job.Table)); err != nil {
+		return job, errors.Wrap(err, "drop reindex table")
+	}
+	job.Status = models.ReindexCancelled
+	job.UpdatedAt = time.Now().Unix()
+	job.FinishedAt = job.UpdatedAt
+	_, err = r.deh.db.Model(&job).Column("status", "updatedAt", "finishedAt").WherePK().Update()
+	return job, err
+}
+
+// acquire marks the unfinished job or a new job as running in this process. Replicas and
+// the reindex command share the jobs, so a job is only run by the holder of their lock.
+func (r *Reindexer) acquire(fromBlock uint64) (models.ReindexJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running != 0 {
+		return models.ReindexJob{ID: r.running}, models.ErrReindexRunning
+	}
+
+	conn := r.deh.db.Conn()
+	var locked bool
+	if _, err := conn.QueryOne(pg.Scan(&locked), `SELECT pg_try_advisory_lock(hashtext(current_schema() || '.' || ?))`, reindexLockName); err != nil {
+		conn.Close()
+		return models.ReindexJob{}, errors.Wrap(err, "lock reindex jobs")
+	}
+	if !locked {
+		conn.Close()
+		return models.ReindexJob{}, models.ErrReindexRunning
+	}
+	job, err := r.next(fromBlock)
+	if err != nil {
+		unlock(conn)
+		return job, err
+	}
+	r.running = job.ID
+	r.conn = conn
+	return job, nil
+}
+
+// next marks the unfinished job or a new job as running
+func (r *Reindexer) next(fromBlock uint64) (models.ReindexJob, error) {
+	job := models.ReindexJob{}
+	err := r.deh.db.Model(&job).
+		WhereIn("status IN (?)", []models.ReindexStatus{models.ReindexRunning, models.ReindexFailed}).
+		Order("id DESC").
+		Limit(1).
+		Select()
+	switch err {
+	case nil:
+		klog.Infof("Resuming reindex job %d from block %d", job.ID, job.NextBlock)
+		job.Status = models.ReindexRunning
+		job.Error = ""
+		job.UpdatedAt = time.Now().Unix()
+		if _, err = r.deh.db.Model(&job).Column("status", "error", "updatedAt").WherePK().Update(); err != nil {
+			return job, errors.Wrap(err, "update reindex job")
+		}
+	case pg.ErrNoRows:
+		if job, err = r.create(fromBlock); err != nil {
+			return job, err
+		}
+		klog.Infof("Starting reindex job %d from block %d to %d", job.ID, job.FromBlock, job.TargetBlock)
+	default:
+		return job, errors.Wrap(err, "get unfinished reindex job")
+	}
+	return job, nil
+}
+
+// unlock releases the lock of reindex jobs held by conn. Closing conn is not enough, as it
+// goes back to the pool with the session.
+func unlock(conn *pg.Conn) {
+	if _, err := conn.Exec(`SELECT pg_advisory_unlock(hashtext(current_schema() || '.' || ?))`, reindexLockName); err != nil {
+		klog.Errorf("[Error] unlock reindex jobs error %s", err)
+	}
+	conn.Close()
+}
+
+// create inserts a new job and creates its table like the current index
+func (r *Reindexer) create(fromBlock uint64) (models.ReindexJob, error) {
+	info, err := r.deh.qscc.GetChainInfo()
+	if err != nil {
+		return models.ReindexJob{}, errors.Wrap(err, "get chain info")
+	}
+	total, err := r.deh.contractClient.Total()
+	if err != nil {
+		return models.ReindexJob{}, errors.Wrap(err, "get total of depositories")
+	}
+	now := time.Now().Unix()
+	job := models.ReindexJob{
+		Status:      models.ReindexRunning,
+		FromBlock:   fromBlock,
+		NextBlock:   fromBlock,
+		TargetBlock: info.GetHeight(),
+		Total:       total,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err = r.deh.db.RunInTransaction(context.TODO(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&job).Insert(); err != nil {
+			return errors.Wrap(err, "insert reindex job")
+		}
+		job.Table = fmt.Sprintf("%s_reindex_%d", models.TableName((*models.Depository)(nil)), job.ID)
+		if _, err := tx.Model(&job).Column("table").WherePK().Update(); err != nil {
+			return errors.Wrap(err, "update reindex job")
+		}
+		_, err := tx.Model((*models.Depository)(nil)).Exec(`CREATE TABLE ? (LIKE ?TableName INCLUDING ALL)`, pg.Ident(job.Table))
+		return errors.Wrap(err, "create reindex table")
+	})
+	return job, err
+}
+
+// run replays blocks of job until the ledger height, then swaps its table in
+func (r *Reindexer) run(ctx context.Context, job models.ReindexJob) (models.ReindexJob, error) {
+	defer func() {
+		r.mu.Lock()
+		unlock(r.conn)
+		r.running = 0
+		r.conn = nil
+		r.mu.Unlock()
+	}()
+
+	err := r.replay(ctx, &job)
+	if err == nil {
+		err = r.swap(ctx, &job)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// interrupted or cancelled, which is resumed or already recorded
+			return job, err
+		}
+		job.Status = models.ReindexFailed
+		job.Error = err.Error()
+		job.UpdatedAt = time.Now().Unix()
+		// job may have been cancelled by another replica
+		_, uerr := r.deh.db.Model(&job).Column("status", "error", "updatedAt").WherePK().
+			Where("status = ?", models.ReindexRunning).
+			Update()
+		if uerr != nil {
+			klog.Errorf("[Error] update reindex job %d error %s", job.ID, uerr)
+		}
+		return job, err
+	}
+	klog.Infof("[Success] reindex job %d completed with %d depositories, %d on ledger", job.ID, job.Indexed, job.Total)
+	return job, nil
+}
+
+// replay indexes depositories in blocks from job.NextBlock. Blocks committed meanwhile are
+// also replayed, until the ledger height is reached.
+func (r *Reindexer) replay(ctx context.Context, job *models.ReindexJob) error {
+	for {
+		for ; job.NextBlock < job.TargetBlock; job.NextBlock++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := r.replayBlock(ctx, job); err != nil {
+				return errors.Wrapf(err, "replay block %d", job.NextBlock)
+			}
+			if job.NextBlock%reindexLogInterval == 0 {
+				klog.Infof("reindex job %d: block %d/%d, %d depositories indexed", job.ID, job.NextBlock, job.TargetBlock, job.Indexed)
+			}
+		}
+		info, err := r.deh.qscc.GetChainInfo()
+		if err != nil {
+			return errors.Wrap(err, "get chain info")
+		}
+		if info.GetHeight() <= job.TargetBlock {
+			return nil
+		}
+		job.TargetBlock = info.GetHeight()
+	}
+}
+
+// replayBlock indexes depositories in block job.NextBlock together with the progress of job
+func (r *Reindexer) replayBlock(ctx context.Context, job *models.ReindexJob) error {
+	block, err := r.deh.qscc.GetBlockByNumber(job.NextBlock)
+	if err != nil {
+		return err
+	}
+	depositories := make([]*models.Depository, 0)
+	for _, e := range contractEvents(block, r.contract) {
+		if Event(e.EventName) != DepositoryEventPutValue && Event(e.EventName) != DepositoryEventPutUntrustValue {
+			continue
+		}
+		eventPayload := kv{}
+		if err := json.Unmarshal(e.Payload, &eventPayload); err != nil {
+			return errors.Wrapf(err, "unmarshal payload of event in transaction %s", e.TransactionID)
+		}
+		d, err := r.deh.depository(&e.ChaincodeEvent, eventPayload, e.tx)
+		if err != nil {
+			return err
+		}
+		depositories = append(depositories, d)
+	}
+
+	next := *job
+	next.NextBlock++
+	next.UpdatedAt = time.Now().Unix()
+	err = r.deh.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		for _, d := range depositories {
+			// search vector is not marshaled with depository
+			raw, err := json.Marshal(struct {
+				*models.Depository
+				SearchVector string `json:"searchVector"`
+			}{d, models.SearchVector(d)})
+			if err != nil {
+				return err
+			}
+			result, err := tx.Model((*models.Depository)(nil)).Exec(
+				`INSERT INTO ? SELECT * FROM json_populate_record(NULL::?TableName, ?) ON CONFLICT (kid) DO NOTHING`,
+				pg.Ident(job.Table), string(raw),
+			)
+			if err != nil {
+				return errors.Wrapf(err, "insert depository %s", d.KID)
+			}
+			next.Indexed += int64(result.RowsAffected())
+		}
+		_, err := tx.Model(&next).Column("nextBlock", "targetBlock", "indexed", "updatedAt").WherePK().Update()
+		return errors.Wrap(err, "update reindex job")
+	})
+	if err != nil {
+		return err
+	}
+	// NextBlock is increased by the caller
+	job.Indexed = next.Indexed
+	job.UpdatedAt = next.UpdatedAt
+	return nil
+}
+
+// swap replaces the current index with the table of job. Depositories before job.FromBlock,
+// and those indexed by listener after job.NextBlock are copied from the current index, so are
+// timestamp tokens and ingestion time.
+func (r *Reindexer) swap(ctx context.Context, job *models.ReindexJob) error {
+	table := pg.Ident(job.Table)
+	return r.deh.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		model := tx.Model((*models.Depository)(nil))
+		// block listener from inserting until swapped
+		if _, err := model.Exec(`LOCK TABLE ?TableName IN ACCESS EXCLUSIVE MODE`); err != nil {
+			return errors.Wrap(err, "lock depository table")
+		}
+		if _, err := model.Exec(
+			`INSERT INTO ? SELECT * FROM ?TableName WHERE "blockNumber" < ? OR "blockNumber" >= ? ON CONFLICT (kid) DO NOTHING`,
+			table, job.FromBlock, job.NextBlock,
+		); err != nil {
+			return errors.Wrap(err, "copy depositories out of replayed blocks")
+		}
+		if _, err := model.Exec(
+			`UPDATE ? AS n SET "ingestedAt" = o."ingestedAt", "timestampToken" = o."timestampToken", "timestampTokenTime" = o."timestampTokenTime"
+			FROM ?TableName AS o WHERE n.kid = o.kid AND n."contentID" = o."contentID"`,
+			table,
+		); err != nil {
+			return errors.Wrap(err, "copy timestamp tokens")
+		}
+		var count int64
+		if _, err := tx.QueryOne(pg.Scan(&count), `SELECT count(*) FROM ?`, table); err != nil {
+			return errors.Wrap(err, "count reindexed depositories")
+		}
+		renames, err := indexRenames(tx, job.Table, models.TableName((*models.Depository)(nil)))
+		if err != nil {
+			return err
+		}
+		if _, err := model.Exec(`DROP TABLE ?TableName`); err != nil {
+			return errors.Wrap(err, "drop depository table")
+		}
+		if _, err := tx.Exec(`ALTER TABLE ? RENAME TO ?`, table, pg.Ident(models.TableName((*models.Depository)(nil)))); err != nil {
+			return errors.Wrap(err, "rename reindex table")
+		}
+		// migrations find indexes and the primary key by their names
+		for _, rename := range renames {
+			if _, err := tx.Exec(`ALTER INDEX ? RENAME TO ?`, pg.Ident(rename.From), pg.Ident(rename.To)); err != nil {
+				return errors.Wrapf(err, "rename index %s", rename.From)
+			}
+		}
+
+		job.Status = models.ReindexCompleted
+		job.Indexed = count
+		job.UpdatedAt = time.Now().Unix()
+		job.FinishedAt = job.UpdatedAt
+		_, err = tx.Model(job).Column("status", "indexed", "updatedAt", "finishedAt").WherePK().Update()
+		return errors.Wrap(err, "update reindex job")
+	})
+}
+
+type indexRename struct {
+	From string `pg:"from"`
+	To   string `pg:"to"`
+}
+
+// indexRenames pairs indexes of table, which were copied from those of origin and named after
+// table, with the same ones of origin. Indexes of constraints are renamed with constraints.
+func indexRenames(tx *pg.Tx, table string, origin string) ([]indexRename, error) {
+	renames := make([]indexRename, 0)
+	// index definitions without index and table names
+	_, err := tx.Query(&renames, `SELECT t.indexname AS "from", o.indexname AS "to"
+		FROM pg_indexes AS t JOIN pg_indexes AS o
+		ON regexp_replace(t.indexdef, 'INDEX \S+ ON \S+ ', 'INDEX ON ') = regexp_replace(o.indexdef, 'INDEX \S+ ON \S+ ', 'INDEX ON ')
+		WHERE t.schemaname = current_schema() AND t.tablename = ? AND o.schemaname = current_schema() AND o.tablename = ?`,
+		table, origin)
+	if err != nil {
+		return nil, errors.Wrap(err, "list indexes to rename")
+	}
+	return renames, nil
+}
+
+type contractEvent struct {
+	client.ChaincodeEvent
+	tx *utils.ChaincodeTransaction
+}
+
+// contractEvents returns chaincode events of contract emitted by valid transactions in block
+func contractEvents(block *common.Block, contract string) []contractEvent {
+	result := make([]contractEvent, 0)
+	for i, data := range block.GetData().GetData() {
+		if utils.TxValidationCode(block, i) != peer.TxValidationCode_VALID {
+			continue
+		}
+		env := &common.Envelope{}
+		if err := proto.Unmarshal(data, env); err != nil {
+			klog.Errorf("[Error] unmarshal envelope %d in block %d: %s", i, block.GetHeader().GetNumber(), err)
+			continue
+		}
+		tx, err := utils.ParseChaincodeTransaction(env)
+		if err != nil {
+			if err != utils.ErrNotEndorserTransaction {
+				klog.Errorf("[Error] parse transaction %d in block %d: %s", i, block.GetHeader().GetNumber(), err)
+			}
+			continue
+		}
+		if tx.ChaincodeName != contract || tx.Event == nil || tx.Event.GetEventName() == "" {
+			continue
+		}
+		result = append(result, contractEvent{
+			ChaincodeEvent: client.ChaincodeEvent{
+				BlockNumber:   block.GetHeader().GetNumber(),
+				TransactionID: tx.ChannelHeader.GetTxId(),
+				ChaincodeName: tx.ChaincodeName,
+				EventName:     tx.Event.GetEventName(),
+				Payload:       tx.Event.GetPayload(),
+			},
+			tx: tx,
+		})
+	}
+	return result
+}
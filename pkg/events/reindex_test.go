@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+func marshal(t *testing.T, m proto.Message) []byte {
+	result, err := proto.Marshal(m)
+	require.NoError(t, err)
+	return result
+}
+
+// testEnvelope returns a transaction txID of contract which emits event
+func testEnvelope(t *testing.T, txID string, contract string, event string) []byte {
+	action := &peer.ChaincodeAction{ChaincodeId: &peer.ChaincodeID{Name: contract}}
+	if event != "" {
+		action.Events = marshal(t, &peer.ChaincodeEvent{ChaincodeId: contract, TxId: txID, EventName: event, Payload: []byte(`{"kid":"` + txID + `"}`)})
+	}
+	invocation := &peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: contract},
+		Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte(event)}},
+	}}
+	actionPayload := &peer.ChaincodeActionPayload{
+		ChaincodeProposalPayload: marshal(t, &peer.ChaincodeProposalPayload{Input: marshal(t, invocation)}),
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: marshal(t, &peer.ProposalResponsePayload{Extension: marshal(t, action)}),
+		},
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   marshal(t, &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: txID}),
+			SignatureHeader: marshal(t, &common.SignatureHeader{}),
+		},
+		Data: marshal(t, &peer.Transaction{Actions: []*peer.TransactionAction{{Payload: marshal(t, actionPayload)}}}),
+	}
+	return marshal(t, &common.Envelope{Payload: marshal(t, payload)})
+}
+
+// TestContractEvents tests only events of contract in valid transactions are replayed
+func TestContractEvents(t *testing.T) {
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 7},
+		Data: &common.BlockData{Data: [][]byte{
+			testEnvelope(t, "tx1", "depository", "PutValue"),
+			testEnvelope(t, "tx2", "depository", "PutValue"),
+			testEnvelope(t, "tx3", "market", "PutValue"),
+			testEnvelope(t, "tx4", "depository", ""),
+			testEnvelope(t, "tx5", "depository", "PutUntrustValue"),
+		}},
+		Metadata: &common.BlockMetadata{Metadata: make([][]byte, len(common.BlockMetadataIndex_name))},
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = []byte{
+		byte(peer.TxValidationCode_VALID),
+		byte(peer.TxValidationCode_MVCC_READ_CONFLICT),
+		byte(peer.TxValidationCode_VALID),
+		byte(peer.TxValidationCode_VALID),
+		byte(peer.TxValidationCode_VALID),
+	}
+
+	result := contractEvents(block, "depository")
+	require.Len(t, result, 2)
+	assert.Equal(t, "tx1", result[0].TransactionID)
+	assert.Equal(t, uint64(7), result[0].BlockNumber)
+	assert.Equal(t, "PutValue", result[0].EventName)
+	assert.Equal(t, []byte(`{"kid":"tx1"}`), result[0].Payload)
+	assert.Equal(t, "tx5", result[1].TransactionID)
+	assert.Equal(t, "PutUntrustValue", result[1].EventName)
+}
+
+// testPostgres connects to the postgres of BC_SAAS_TEST_POSTGRES in a fresh schema, or skips t
+func testPostgres(t *testing.T) *pg.DB {
+	dsn := os.Getenv("BC_SAAS_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("BC_SAAS_TEST_POSTGRES is not set")
+	}
+	opts, err := pg.ParseURL(dsn)
+	require.NoError(t, err)
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	opts.OnConnect = func(ctx context.Context, cn *pg.Conn) error {
+		_, err := cn.ExecContext(ctx, `SET search_path TO ?, public`, pg.Ident(schema))
+		return err
+	}
+	db := pg.Connect(opts)
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DROP SCHEMA IF EXISTS ? CASCADE`, pg.Ident(schema))
+		db.Close()
+	})
+	_, err = db.Exec(`CREATE SCHEMA ?`, pg.Ident(schema))
+	require.NoError(t, err)
+	_, err = models.Migrate(db)
+	require.NoError(t, err)
+	return db
+}
+
+func indexNames(t *testing.T, db *pg.DB, table string) []string {
+	var names []string
+	_, err := db.Query(&names, `SELECT indexname FROM pg_indexes WHERE schemaname = current_schema() AND tablename = ? ORDER BY indexname`, table)
+	require.NoError(t, err)
+	return names
+}
+
+// TestReindexer_swap tests indexes of a swapped in table keep their names, so migrations
+// applied after a reindex don't duplicate them
+func TestReindexer_swap(t *testing.T) {
+	db := testPostgres(t)
+	table := models.TableName((*models.Depository)(nil))
+	indexes := indexNames(t, db, table)
+	require.Contains(t, indexes, table+"_pkey")
+
+	job := &models.ReindexJob{Status: models.ReindexRunning}
+	_, err := db.Model(job).Insert()
+	require.NoError(t, err)
+	job.Table = fmt.Sprintf("%s_reindex_%d", table, job.ID)
+	_, err = db.Model(job).Column("table").WherePK().Update()
+	require.NoError(t, err)
+	_, err = db.Model((*models.Depository)(nil)).Exec(`CREATE TABLE ? (LIKE ?TableName INCLUDING ALL)`, pg.Ident(job.Table))
+	require.NoError(t, err)
+
+	r := NewReindexer(&DepositoryEventHandler{db: db}, "depository")
+	require.NoError(t, r.swap(context.Background(), job))
+	assert.Equal(t, indexes, indexNames(t, db, table))
+	for _, name := range indexNames(t, db, table) {
+		assert.False(t, strings.Contains(name, "_reindex_"), name)
+	}
+
+	// migrations after the first one are applied again
+	_, err = db.Model((*models.SchemaMigration)(nil)).Where("version > 1").Delete()
+	require.NoError(t, err)
+	_, err = models.Migrate(db)
+	require.NoError(t, err)
+	assert.Equal(t, indexes, indexNames(t, db, table))
+}
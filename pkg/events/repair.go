@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+const repairBatchSize = 100
+
+// RepairTimestamps rewrites trustedTimestamp of all indexed depositories with the
+// transaction timestamp on ledger. Depositories indexed before ingestedAt existed
+// used ingestion time as trustedTimestamp, so it is kept as ingestedAt.
+func (deh *DepositoryEventHandler) RepairTimestamps(ctx context.Context) (int, error) {
+	repaired := 0
+	lastKID := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return repaired, ctx.Err()
+		default:
+		}
+
+		batch := make([]models.Depository, 0, repairBatchSize)
+		err := deh.db.Model(&batch).
+			Where("kid > ?", lastKID).
+			Order("kid asc").
+			Limit(repairBatchSize).
+			Select()
+		if err != nil {
+			return repaired, errors.Wrap(err, "list depositories")
+		}
+		if len(batch) == 0 {
+			return repaired, nil
+		}
+		lastKID = batch[len(batch)-1].KID
+
+		for _, d := range batch {
+			changed, err := repairTimestamp(&d, deh.qscc)
+			if err != nil {
+				klog.Errorf("[Error] get timestamp of transaction %s for depository %s: %s", d.TransactionID, d.KID, err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if _, err := deh.db.Model(&d).Column("trustedTimestamp", "ingestedAt").WherePK().Update(); err != nil {
+				return repaired, errors.Wrapf(err, "update depository %s", d.KID)
+			}
+			klog.Infof("[Success] repair trustedTimestamp of depository %s to %d", d.KID, d.TrustedTimestamp)
+			repaired++
+		}
+	}
+}
+
+// timestampGetter gets timestamps of transactions on ledger, implemented by *contracts.QSCC
+type timestampGetter interface {
+	GetTransactionTimestamp(txID string) (int64, error)
+}
+
+// repairTimestamp sets trustedTimestamp of d to the timestamp of its transaction on ledger,
+// and returns whether d is changed
+func repairTimestamp(d *models.Depository, ledger timestampGetter) (bool, error) {
+	trustedTimestamp, err := ledger.GetTransactionTimestamp(d.TransactionID)
+	if err != nil {
+		return false, err
+	}
+	if trustedTimestamp == d.TrustedTimestamp {
+		return false, nil
+	}
+	if d.IngestedAt == 0 {
+		d.IngestedAt = d.TrustedTimestamp
+	}
+	d.TrustedTimestamp = trustedTimestamp
+	return true, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+// fakeLedger has timestamps of transactions by id
+type fakeLedger map[string]int64
+
+func (l fakeLedger) GetTransactionTimestamp(txID string) (int64, error) {
+	timestamp, ok := l[txID]
+	if !ok {
+		return 0, errors.Errorf("transaction %s not found", txID)
+	}
+	return timestamp, nil
+}
+
+// TestRepairTimestamp tests trustedTimestamp is rewritten with the ledger timestamp
+// and the ingestion time in it is kept as ingestedAt
+func TestRepairTimestamp(t *testing.T) {
+	ledger := fakeLedger{"tx1": 1682406000, "tx2": 1682406100, "tx3": 1682406200}
+
+	// indexed before ingestedAt existed
+	d := &models.Depository{KID: "kid1", TransactionID: "tx1", TrustedTimestamp: 1682406290}
+	changed, err := repairTimestamp(d, ledger)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, int64(1682406000), d.TrustedTimestamp)
+	assert.Equal(t, int64(1682406290), d.IngestedAt)
+
+	// ingestedAt is not overwritten
+	d = &models.Depository{KID: "kid2", TransactionID: "tx2", TrustedTimestamp: 1682406290, IngestedAt: 1682406300}
+	changed, err = repairTimestamp(d, ledger)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, int64(1682406100), d.TrustedTimestamp)
+	assert.Equal(t, int64(1682406300), d.IngestedAt)
+
+	// already repaired
+	d = &models.Depository{KID: "kid3", TransactionID: "tx3", TrustedTimestamp: 1682406200}
+	changed, err = repairTimestamp(d, ledger)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Zero(t, d.IngestedAt)
+
+	// unknown transactions are left as is
+	d = &models.Depository{KID: "kid4", TransactionID: "tx4", TrustedTimestamp: 1682406290}
+	changed, err = repairTimestamp(d, ledger)
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, int64(1682406290), d.TrustedTimestamp)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package evidence builds and verifies offline evidence bundles of depositories.
+// A bundle carries everything needed to prove a depository on ledger, so it can be
+// verified by a third party without access to bc-saas or the blockchain network.
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bestchains/bc-saas/pkg/utils"
+)
+
+// Version of bundle format
+const Version = 1
+
+// Bundle is the evidence of a depository
+type Bundle struct {
+	Version  int    `json:"version"`
+	Channel  string `json:"channel"`
+	Contract string `json:"contract"`
+
+	// KID and Value of the depository
+	KID   string `json:"kid"`
+	Value string `json:"value"`
+	// TransactionID which put the depository on ledger
+	TransactionID string `json:"transactionID"`
+	// Block is the protobuf encoded block which contains the transaction envelope with endorsements
+	Block []byte `json:"block"`
+	// MSPs of organizations in channel when the block was created
+	MSPs []MSP `json:"msps"`
+
+	CreatedAt int64 `json:"createdAt"`
+}
+
+// MSP holds certificates of an organization
+type MSP struct {
+	ID string `json:"id"`
+	// RootCerts and IntermediateCerts in PEM
+	RootCerts         [][]byte `json:"rootCerts"`
+	IntermediateCerts [][]byte `json:"intermediateCerts,omitempty"`
+}
+
+// SignedBundle is a bundle signed by the identity of issuer
+type SignedBundle struct {
+	// Bundle is the json encoded Bundle
+	Bundle json.RawMessage `json:"bundle"`
+	// MSPID and Certificate(PEM) of issuer
+	MSPID       string `json:"mspID,omitempty"`
+	Certificate []byte `json:"certificate,omitempty"`
+	// Signature on SHA-256 digest of Bundle
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Ledger provides blocks to build bundles
+type Ledger interface {
+	GetBlockByTxID(txID string) (*common.Block, error)
+	GetBlockByNumber(number uint64) (*common.Block, error)
+}
+
+// Builder builds signed bundles
+type Builder struct {
+	ledger   Ledger
+	channel  string
+	contract string
+
+	// id and sign to sign bundles. Optional
+	id   identity.Identity
+	sign identity.Sign
+}
+
+func NewBuilder(ledger Ledger, channel string, contract string, id identity.Identity, sign identity.Sign) (*Builder, error) {
+	if ledger == nil || contract == "" {
+		return nil, errors.New("invalid arguments")
+	}
+	return &Builder{
+		ledger:   ledger,
+		channel:  channel,
+		contract: contract,
+		id:       id,
+		sign:     sign,
+	}, nil
+}
+
+// Build builds a bundle for depository kid with value which is put on ledger by transaction txID
+func (b *Builder) Build(kid string, value string, txID string) (*SignedBundle, error) {
+	block, err := b.ledger.GetBlockByTxID(txID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get block of transaction %s", txID)
+	}
+	lastConfig, err := utils.LastConfigIndex(block)
+	if err != nil {
+		return nil, err
+	}
+	configBlock, err := b.ledger.GetBlockByNumber(lastConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get config block %d", lastConfig)
+	}
+	msps, err := MSPsFromConfigBlock(configBlock)
+	if err != nil {
+		return nil, err
+	}
+	rawBlock, err := proto.Marshal(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal block")
+	}
+
+	bundle := &Bundle{
+		Version:       Version,
+		Channel:       b.channel,
+		Contract:      b.contract,
+		KID:           kid,
+		Value:         value,
+		TransactionID: txID,
+		Block:         rawBlock,
+		MSPs:          msps,
+		CreatedAt:     time.Now().Unix(),
+	}
+
+	rawBundle, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal bundle")
+	}
+	signed := &SignedBundle{Bundle: rawBundle}
+	if b.id != nil && b.sign != nil {
+		digest := sha256.Sum256(rawBundle)
+		signed.Signature, err = b.sign(digest[:])
+		if err != nil {
+			return nil, errors.Wrap(err, "sign bundle")
+		}
+		signed.MSPID = b.id.MspID()
+		signed.Certificate = b.id.Credentials()
+	}
+	return signed, nil
+}
+
+// MSPsFromConfigBlock returns certificates of organizations in a channel config block
+func MSPsFromConfigBlock(configBlock *common.Block) ([]MSP, error) {
+	mspConfigs, err := utils.ChannelMSPs(configBlock)
+	if err != nil {
+		return nil, err
+	}
+	msps := make([]MSP, 0, len(mspConfigs))
+	for _, mspConfig := range mspConfigs {
+		msps = append(msps, MSP{
+			ID:                mspConfig.GetName(),
+			RootCerts:         mspConfig.GetRootCerts(),
+			IntermediateCerts: mspConfig.GetIntermediateCerts(),
+		})
+	}
+	return msps, nil
+}
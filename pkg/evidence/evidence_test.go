@@ -0,0 +1,346 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evidence
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bestchains/bc-saas/pkg/utils"
+)
+
+const (
+	testMSPID    = "Org1MSP"
+	testContract = "depository"
+	testTxID     = "tx1"
+	testKID      = "kid1"
+	testValue    = "value1"
+)
+
+// testOrg is an organization with a self-signed CA and one member which plays every role
+type testOrg struct {
+	caCert     *x509.Certificate
+	cert       *x509.Certificate
+	key        *ecdsa.PrivateKey
+	serialized []byte
+}
+
+func newTestOrg(t *testing.T) *testOrg {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.org1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "member.org1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err = x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	serialized, err := proto.Marshal(&msp.SerializedIdentity{Mspid: testMSPID, IdBytes: toPEM(cert)})
+	require.NoError(t, err)
+	return &testOrg{caCert: caCert, cert: cert, key: key, serialized: serialized}
+}
+
+func toPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func (o *testOrg) sign(t *testing.T, msg ...[]byte) []byte {
+	digest := sha256.Sum256(bytes.Join(msg, nil))
+	signature, err := ecdsa.SignASN1(rand.Reader, o.key, digest[:])
+	require.NoError(t, err)
+	return signature
+}
+
+func marshal(t *testing.T, m proto.Message) []byte {
+	result, err := proto.Marshal(m)
+	require.NoError(t, err)
+	return result
+}
+
+// fakeLedger serves a config block 0 and a block 1 with one depository transaction
+type fakeLedger struct {
+	blocks map[uint64]*common.Block
+}
+
+func newFakeLedger(t *testing.T, org *testOrg) *fakeLedger {
+	mspConfig := marshal(t, &msp.MSPConfig{Config: marshal(t, &msp.FabricMSPConfig{
+		Name:      testMSPID,
+		RootCerts: [][]byte{toPEM(org.caCert)},
+	})})
+	configEnv := &common.ConfigEnvelope{Config: &common.Config{ChannelGroup: &common.ConfigGroup{
+		Groups: map[string]*common.ConfigGroup{
+			"Application": {Groups: map[string]*common.ConfigGroup{
+				"Org1": {Values: map[string]*common.ConfigValue{"MSP": {Value: mspConfig}}},
+			}},
+		},
+	}}}
+	configBlock := &common.Block{
+		Header: &common.BlockHeader{Number: 0},
+		Data: &common.BlockData{Data: [][]byte{marshal(t, &common.Envelope{
+			Payload: marshal(t, &common.Payload{Data: marshal(t, configEnv)}),
+		})}},
+	}
+
+	// endorsed transaction which writes the depository
+	kvRWSet := &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: testKID, Value: []byte(testValue)}}}
+	results := &rwset.TxReadWriteSet{NsRwset: []*rwset.NsReadWriteSet{{Namespace: testContract, Rwset: marshal(t, kvRWSet)}}}
+	action := &peer.ChaincodeAction{Results: marshal(t, results), ChaincodeId: &peer.ChaincodeID{Name: testContract}}
+	prp := marshal(t, &peer.ProposalResponsePayload{Extension: marshal(t, action)})
+	invocation := &peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: testContract},
+		Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte("PutValue"), []byte(testValue)}},
+	}}
+	actionPayload := &peer.ChaincodeActionPayload{
+		ChaincodeProposalPayload: marshal(t, &peer.ChaincodeProposalPayload{Input: marshal(t, invocation)}),
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: prp,
+			Endorsements:            []*peer.Endorsement{{Endorser: org.serialized, Signature: org.sign(t, prp, org.serialized)}},
+		},
+	}
+	shdr := marshal(t, &common.SignatureHeader{Creator: org.serialized, Nonce: []byte("nonce")})
+	chdr := marshal(t, &common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: "channel",
+		TxId:      testTxID,
+		Timestamp: timestamppb.Now(),
+	})
+	payload := marshal(t, &common.Payload{
+		Header: &common.Header{ChannelHeader: chdr, SignatureHeader: shdr},
+		Data:   marshal(t, &peer.Transaction{Actions: []*peer.TransactionAction{{Header: shdr, Payload: marshal(t, actionPayload)}}}),
+	})
+	env := marshal(t, &common.Envelope{Payload: payload, Signature: org.sign(t, payload)})
+
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 1, PreviousHash: utils.BlockHeaderHash(configBlock.Header)},
+		Data:   &common.BlockData{Data: [][]byte{env}},
+	}
+	block.Header.DataHash = utils.BlockDataHash(block.Data)
+	value := marshal(t, &common.OrdererBlockMetadata{LastConfig: &common.LastConfig{Index: 0}})
+	signatures := &common.Metadata{
+		Value: value,
+		Signatures: []*common.MetadataSignature{{
+			SignatureHeader: shdr,
+			Signature:       org.sign(t, value, shdr, utils.BlockHeaderBytes(block.Header)),
+		}},
+	}
+	block.Metadata = &common.BlockMetadata{Metadata: make([][]byte, len(common.BlockMetadataIndex_name))}
+	block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = marshal(t, signatures)
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = []byte{byte(peer.TxValidationCode_VALID)}
+
+	return &fakeLedger{blocks: map[uint64]*common.Block{0: configBlock, 1: block}}
+}
+
+func (l *fakeLedger) GetBlockByTxID(txID string) (*common.Block, error) {
+	if txID != testTxID {
+		return nil, errors.New("transaction not found")
+	}
+	return l.blocks[1], nil
+}
+
+func (l *fakeLedger) GetBlockByNumber(number uint64) (*common.Block, error) {
+	block, ok := l.blocks[number]
+	if !ok {
+		return nil, errors.New("block not found")
+	}
+	return block, nil
+}
+
+func newTestBuilder(t *testing.T) *Builder {
+	org := newTestOrg(t)
+	id, err := identity.NewX509Identity(testMSPID, org.cert)
+	require.NoError(t, err)
+	sign, err := identity.NewPrivateKeySign(org.key)
+	require.NoError(t, err)
+	builder, err := NewBuilder(newFakeLedger(t, org), "channel", testContract, id, sign)
+	require.NoError(t, err)
+	return builder
+}
+
+// trustedMSPs returns msps from the config block of ledger, as pinned by a verifier
+func trustedMSPs(t *testing.T, builder *Builder) []MSP {
+	msps, err := MSPsFromConfigBlock(builder.ledger.(*fakeLedger).blocks[0])
+	require.NoError(t, err)
+	return msps
+}
+
+func failedChecks(report *Report) []string {
+	failed := make([]string, 0)
+	for _, c := range report.Checks {
+		if !c.Passed {
+			failed = append(failed, c.Name)
+		}
+	}
+	return failed
+}
+
+// TestBuildAndVerify tests a bundle can be verified offline after a json round trip
+func TestBuildAndVerify(t *testing.T) {
+	builder := newTestBuilder(t)
+	signed, err := builder.Build(testKID, testValue, testTxID)
+	require.NoError(t, err)
+
+	raw, err := json.MarshalIndent(signed, "", "  ")
+	require.NoError(t, err)
+	loaded := &SignedBundle{}
+	require.NoError(t, json.Unmarshal(raw, loaded))
+
+	report, err := Verify(loaded, trustedMSPs(t, builder))
+	require.NoError(t, err)
+	assert.Empty(t, failedChecks(report))
+	assert.True(t, report.Valid)
+	assert.Equal(t, testKID, report.KID)
+	assert.Equal(t, uint64(1), report.BlockNumber)
+	require.Len(t, report.Roots, 1)
+	assert.Equal(t, testMSPID, report.Roots[0].MSPID)
+	assert.Len(t, report.Roots[0].SHA256, 64)
+
+	// roots in bundle are not trusted
+	report, err = Verify(loaded, nil)
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+	assert.Equal(t, []string{"trusted roots"}, failedChecks(report))
+
+	// identities are not issued by pinned roots of another organization
+	another := newTestOrg(t)
+	report, err = Verify(loaded, []MSP{{ID: testMSPID, RootCerts: [][]byte{toPEM(another.caCert)}}})
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+	assert.Equal(t, []string{"issuer signature", "orderer signatures", "creator signature", "endorsements"}, failedChecks(report))
+}
+
+// TestVerify_Tampered tests modifications to a bundle are detected
+func TestVerify_Tampered(t *testing.T) {
+	builder := newTestBuilder(t)
+	trusted := trustedMSPs(t, builder)
+
+	// value which is not written by transaction
+	signed, err := builder.Build(testKID, "another value", testTxID)
+	require.NoError(t, err)
+	report, err := Verify(signed, trusted)
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+	assert.Equal(t, []string{"depository value"}, failedChecks(report))
+
+	// bundle modified after signed
+	signed, err = builder.Build(testKID, testValue, testTxID)
+	require.NoError(t, err)
+	bundle := &Bundle{}
+	require.NoError(t, json.Unmarshal(signed.Bundle, bundle))
+	bundle.KID = "kid2"
+	signed.Bundle, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	report, err = Verify(signed, trusted)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"issuer signature", "depository value"}, failedChecks(report))
+
+	// block modified
+	block := &common.Block{}
+	require.NoError(t, proto.Unmarshal(bundle.Block, block))
+	block.Header.Number = 2
+	bundle.KID = testKID
+	bundle.Block = marshal(t, block)
+	signed.Bundle, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	signed.Signature = nil
+	report, err = Verify(signed, trusted)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"issuer signature", "orderer signatures"}, failedChecks(report))
+
+	// transaction not in block
+	bundle.TransactionID = "tx2"
+	signed.Bundle, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	report, err = Verify(signed, trusted)
+	require.NoError(t, err)
+	assert.Contains(t, failedChecks(report), "transaction in block")
+}
+
+// TestVerify_Unsigned tests an unsigned bundle can't claim another kid or channel of the transaction
+func TestVerify_Unsigned(t *testing.T) {
+	builder := newTestBuilder(t)
+	trusted := trustedMSPs(t, builder)
+	signed, err := builder.Build(testKID, testValue, testTxID)
+	require.NoError(t, err)
+	bundle := &Bundle{}
+	require.NoError(t, json.Unmarshal(signed.Bundle, bundle))
+
+	signed.Signature = nil
+	report, err := Verify(signed, trusted)
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+	assert.Equal(t, []string{"issuer signature"}, failedChecks(report))
+
+	// value is written under another key
+	bundle.KID = "kid2"
+	signed.Bundle, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	report, err = Verify(signed, trusted)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"issuer signature", "depository value"}, failedChecks(report))
+
+	// transaction is in another channel
+	bundle.KID = testKID
+	bundle.Channel = "another"
+	signed.Bundle, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	report, err = Verify(signed, trusted)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"issuer signature", "transaction channel"}, failedChecks(report))
+}
@@ -0,0 +1,379 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evidence
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bestchains/bc-saas/pkg/utils"
+)
+
+var (
+	errUnknownMSP       = errors.New("unknown msp")
+	errInvalidSignature = errors.New("invalid signature")
+)
+
+// Check is the result of one verification step
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the result of verifying a bundle
+type Report struct {
+	KID           string    `json:"kid"`
+	TransactionID string    `json:"transactionID"`
+	BlockNumber   uint64    `json:"blockNumber"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Valid only when all checks passed
+	Valid  bool    `json:"valid"`
+	Checks []Check `json:"checks"`
+	// Roots are the root certificates which identities are verified against
+	Roots []Root `json:"roots"`
+}
+
+// Root is a root certificate of a msp
+type Root struct {
+	MSPID   string `json:"mspID"`
+	Subject string `json:"subject"`
+	// SHA256 fingerprint of the certificate in hex
+	SHA256 string `json:"sha256"`
+}
+
+func (r *Report) check(name string, err error, detail string) bool {
+	c := Check{Name: name, Passed: err == nil, Detail: detail}
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, c)
+	return c.Passed
+}
+
+// Verify verifies a signed bundle against root certificates of trusted msps, which must come
+// from outside of the bundle. If trusted is empty, certificates in the bundle are used so that
+// the other checks still run, but the report is never valid as anyone can forge them.
+// An error is returned only if the bundle can not be parsed. Failed checks are in report.
+func Verify(signed *SignedBundle, trusted []MSP) (*Report, error) {
+	// bundle is signed in compact form
+	rawBundle := &bytes.Buffer{}
+	if err := json.Compact(rawBundle, signed.Bundle); err != nil {
+		return nil, errors.Wrap(err, "invalid bundle")
+	}
+	bundle := &Bundle{}
+	if err := json.Unmarshal(rawBundle.Bytes(), bundle); err != nil {
+		return nil, errors.Wrap(err, "unmarshal bundle")
+	}
+	if bundle.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	block := &common.Block{}
+	if err := proto.Unmarshal(bundle.Block, block); err != nil {
+		return nil, errors.Wrap(err, "unmarshal block")
+	}
+	pinned := len(trusted) > 0
+	if !pinned {
+		trusted = bundle.MSPs
+	}
+	msps, roots, err := newMSPs(trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		KID:           bundle.KID,
+		TransactionID: bundle.TransactionID,
+		BlockNumber:   block.GetHeader().GetNumber(),
+		Roots:         roots,
+	}
+	if pinned {
+		report.check("trusted roots", nil, fmt.Sprintf("%d msps pinned", len(trusted)))
+	} else {
+		report.check("trusted roots", errors.New("roots are taken from the bundle and not pinned"), "")
+	}
+
+	// find transaction first to verify certificates at the time of transaction
+	var env *common.Envelope
+	var chdr *common.ChannelHeader
+	var tx *utils.ChaincodeTransaction
+	txIndex := -1
+	for i, data := range block.GetData().GetData() {
+		candidate := &common.Envelope{}
+		if err := proto.Unmarshal(data, candidate); err != nil {
+			continue
+		}
+		candidateHeader, err := utils.ChannelHeaderFromEnvelope(candidate)
+		if err != nil || candidateHeader.GetTxId() != bundle.TransactionID {
+			continue
+		}
+		env, chdr, txIndex = candidate, candidateHeader, i
+		tx, err = utils.ParseChaincodeTransaction(candidate)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse transaction")
+		}
+		report.Timestamp = chdr.GetTimestamp().AsTime()
+		break
+	}
+
+	if len(signed.Signature) > 0 {
+		detail, err := verifyIssuer(signed, rawBundle.Bytes(), msps, report.Timestamp)
+		report.check("issuer signature", err, detail)
+	} else {
+		report.check("issuer signature", errors.New("bundle is not signed"), "")
+	}
+
+	var err2 error
+	if !bytes.Equal(utils.BlockDataHash(block.GetData()), block.GetHeader().GetDataHash()) {
+		err2 = errors.New("data hash mismatch")
+	}
+	report.check("block data hash", err2, fmt.Sprintf("block %d", report.BlockNumber))
+
+	detail, err := verifyOrderers(block, msps, report.Timestamp)
+	report.check("orderer signatures", err, detail)
+
+	if env == nil {
+		report.check("transaction in block", errors.Errorf("transaction %s not found in block", bundle.TransactionID), "")
+		return report.finish(), nil
+	}
+	report.check("transaction in block", nil, fmt.Sprintf("transaction %d in block", txIndex))
+
+	err2 = nil
+	if chdr.GetChannelId() != bundle.Channel {
+		err2 = errors.Errorf("transaction is in channel %s instead of %s", chdr.GetChannelId(), bundle.Channel)
+	}
+	report.check("transaction channel", err2, chdr.GetChannelId())
+
+	code := utils.TxValidationCode(block, txIndex)
+	err2 = nil
+	if code != peer.TxValidationCode_VALID {
+		err2 = errors.Errorf("validation code %s", code)
+	}
+	report.check("transaction valid", err2, code.String())
+
+	cert, err := msps.verify(tx.SignatureHeader.GetCreator(), env.GetPayload(), env.GetSignature(), report.Timestamp)
+	report.check("creator signature", err, subject(tx.Creator.GetMspid(), cert))
+
+	detail, err = verifyEndorsements(tx, msps, report.Timestamp)
+	report.check("endorsements", err, detail)
+
+	detail, err = verifyValue(tx, bundle)
+	report.check("depository value", err, detail)
+
+	return report.finish(), nil
+}
+
+func (r *Report) finish() *Report {
+	r.Valid = true
+	for _, c := range r.Checks {
+		r.Valid = r.Valid && c.Passed
+	}
+	return r
+}
+
+func verifyIssuer(signed *SignedBundle, rawBundle []byte, msps msps, at time.Time) (string, error) {
+	// issuer signs with the fabric identity in msp signed.MSPID
+	id, err := proto.Marshal(&msp.SerializedIdentity{Mspid: signed.MSPID, IdBytes: signed.Certificate})
+	if err != nil {
+		return "", err
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	cert, err := msps.verify(id, rawBundle, signed.Signature, at)
+	return subject(signed.MSPID, cert), err
+}
+
+func verifyOrderers(block *common.Block, msps msps, at time.Time) (string, error) {
+	signatures, err := utils.BlockSignatures(block)
+	if err != nil {
+		return "", err
+	}
+	if len(signatures.GetSignatures()) == 0 {
+		return "", errors.New("block is not signed")
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	headerBytes := utils.BlockHeaderBytes(block.GetHeader())
+	signers := make([]string, 0, len(signatures.GetSignatures()))
+	for _, signature := range signatures.GetSignatures() {
+		shdr := &common.SignatureHeader{}
+		if err := proto.Unmarshal(signature.GetSignatureHeader(), shdr); err != nil {
+			return "", errors.Wrap(err, "unmarshal signature header")
+		}
+		signedBytes := bytes.Join([][]byte{signatures.GetValue(), signature.GetSignatureHeader(), headerBytes}, nil)
+		cert, err := msps.verify(shdr.GetCreator(), signedBytes, signature.GetSignature(), at)
+		if err != nil {
+			return "", err
+		}
+		signers = append(signers, cert.Subject.CommonName)
+	}
+	return fmt.Sprintf("signed by %v", signers), nil
+}
+
+func verifyEndorsements(tx *utils.ChaincodeTransaction, msps msps, at time.Time) (string, error) {
+	if len(tx.Endorsements) == 0 {
+		return "", errors.New("no endorsement")
+	}
+	endorsers := make([]string, 0, len(tx.Endorsements))
+	for _, endorsement := range tx.Endorsements {
+		signedBytes := bytes.Join([][]byte{tx.ProposalResponsePayload, endorsement.GetEndorser()}, nil)
+		cert, err := msps.verify(endorsement.GetEndorser(), signedBytes, endorsement.GetSignature(), at)
+		if err != nil {
+			return "", err
+		}
+		id := &msp.SerializedIdentity{}
+		_ = proto.Unmarshal(endorsement.GetEndorser(), id)
+		endorsers = append(endorsers, subject(id.GetMspid(), cert))
+	}
+	return fmt.Sprintf("endorsed by %v", endorsers), nil
+}
+
+func verifyValue(tx *utils.ChaincodeTransaction, bundle *Bundle) (string, error) {
+	if tx.ChaincodeName != bundle.Contract {
+		return "", errors.Errorf("transaction invokes %s instead of %s", tx.ChaincodeName, bundle.Contract)
+	}
+	if bundle.KID == "" {
+		return "", errors.New("empty kid")
+	}
+	// value must be written under the key of kid, as the same value may be put under another kid
+	for _, write := range tx.Writes[bundle.Contract] {
+		if !write.GetIsDelete() && utils.IsKeyOf(write.GetKey(), bundle.KID) &&
+			bytes.Equal(write.GetValue(), []byte(bundle.Value)) {
+			return fmt.Sprintf("written to key %q", write.GetKey()), nil
+		}
+	}
+	return "", errors.Errorf("value of %s not found in write set of transaction", bundle.KID)
+}
+
+func subject(mspID string, cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s(%s)", cert.Subject.CommonName, mspID)
+}
+
+// msps verifies identities against certificates of organizations
+type msps map[string]*x509.VerifyOptions
+
+func newMSPs(mspList []MSP) (msps, []Root, error) {
+	result := make(msps, len(mspList))
+	roots := make([]Root, 0, len(mspList))
+	for _, m := range mspList {
+		// certificates of the same msp may come from several sources
+		opts, ok := result[m.ID]
+		if !ok {
+			opts = &x509.VerifyOptions{
+				Roots:         x509.NewCertPool(),
+				Intermediates: x509.NewCertPool(),
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			}
+		}
+		for _, root := range m.RootCerts {
+			certs, err := parseCertificates(root)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "invalid root certificate of msp %s", m.ID)
+			}
+			for _, cert := range certs {
+				opts.Roots.AddCert(cert)
+				fingerprint := sha256.Sum256(cert.Raw)
+				roots = append(roots, Root{MSPID: m.ID, Subject: cert.Subject.String(), SHA256: hex.EncodeToString(fingerprint[:])})
+			}
+		}
+		for _, intermediate := range m.IntermediateCerts {
+			if !opts.Intermediates.AppendCertsFromPEM(intermediate) {
+				return nil, nil, errors.Errorf("invalid intermediate certificate of msp %s", m.ID)
+			}
+		}
+		result[m.ID] = opts
+	}
+	return result, roots, nil
+}
+
+// parseCertificates parses all certificates in PEM
+func parseCertificates(raw []byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, 1)
+	for block, rest := pem.Decode(raw); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return certs, nil
+}
+
+// verify checks that serialized identity id is issued by its msp and signature is signed by it
+func (m msps) verify(id []byte, msg []byte, signature []byte, at time.Time) (*x509.Certificate, error) {
+	sid := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(id, sid); err != nil {
+		return nil, errors.Wrap(err, "unmarshal identity")
+	}
+	opts, ok := m[sid.GetMspid()]
+	if !ok {
+		return nil, errors.Wrap(errUnknownMSP, sid.GetMspid())
+	}
+	block, _ := pem.Decode(sid.GetIdBytes())
+	if block == nil {
+		return nil, errors.Errorf("invalid certificate of identity in %s", sid.GetMspid())
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse certificate")
+	}
+	verifyOpts := *opts
+	verifyOpts.CurrentTime = at
+	if _, err = cert.Verify(verifyOpts); err != nil {
+		return nil, errors.Wrapf(err, "verify certificate of %s", cert.Subject.CommonName)
+	}
+
+	digest := sha256.Sum256(msg)
+	switch pub := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return cert, errors.Wrapf(errInvalidSignature, "by %s", cert.Subject.CommonName)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, msg, signature) {
+			return cert, errors.Wrapf(errInvalidSignature, "by %s", cert.Subject.CommonName)
+		}
+	default:
+		return cert, errors.Errorf("unsupported public key %T", pub)
+	}
+	return cert, nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bestchains/bc-saas/pkg/depositories"
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+// Format of exported depositories
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatXLSX   Format = "xlsx"
+)
+
+// ContentType returns the MIME type of format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Column of exported depositories
+type Column struct {
+	// Key is the json field of depository, which is also the key in ndjson
+	Key string
+	// Labels are headers of csv and xlsx in certificate styles
+	Labels map[depositories.Style]string
+	Value  func(d *models.Depository) interface{}
+}
+
+// Label returns the header of column in style. Default is CN, the same as certificates.
+func (c Column) Label(style depositories.Style) string {
+	if label, ok := c.Labels[style]; ok {
+		return label
+	}
+	return c.Labels[depositories.StyleCN]
+}
+
+func column(key, cn, eng string, value func(d *models.Depository) interface{}) Column {
+	return Column{Key: key, Labels: map[depositories.Style]string{depositories.StyleCN: cn, depositories.StyleENG: eng}, Value: value}
+}
+
+// columns can be exported, in default order
+var columns = []Column{
+	column("kid", "存证ID", "KID", func(d *models.Depository) interface{} { return d.KID }),
+	column("index", "序号", "Index", func(d *models.Depository) interface{} { return d.Index }),
+	column("name", "存证名称", "Name", func(d *models.Depository) interface{} { return d.Name }),
+	column("contentName", "文件名称", "Content Name", func(d *models.Depository) interface{} { return d.ContentName }),
+	column("contentID", "文件哈希", "Content ID", func(d *models.Depository) interface{} { return d.ContentID }),
+	column("contentType", "文件类型", "Content Type", func(d *models.Depository) interface{} { return d.ContentType }),
+	column("contentSize", "文件大小", "Content Size", func(d *models.Depository) interface{} { return d.ContentSize }),
+	column("description", "描述", "Description", func(d *models.Depository) interface{} { return d.Description }),
+	column("owner", "所有者", "Owner", func(d *models.Depository) interface{} { return d.Owner }),
+	column("operator", "操作者", "Operator", func(d *models.Depository) interface{} { return d.Operator }),
+	column("platform", "平台", "Platform", func(d *models.Depository) interface{} { return d.Platform }),
+	column("blockNumber", "区块高度", "Block Number", func(d *models.Depository) interface{} { return d.BlockNumber }),
+	column("transactionID", "交易哈希", "Transaction Hash", func(d *models.Depository) interface{} { return d.TransactionID }),
+	column("trustedTimestamp", "可信时间戳", "Trusted Timestamp", func(d *models.Depository) interface{} { return d.TrustedTimestamp }),
+	column("timestampTokenTime", "TSA时间戳", "TSA Timestamp", func(d *models.Depository) interface{} { return d.TimestampTokenTime }),
+	column("ingestedAt", "索引时间", "Ingested At", func(d *models.Depository) interface{} { return d.IngestedAt }),
+}
+
+// Columns returns columns of comma separated keys. All columns are returned if keys is empty.
+func Columns(keys string) ([]Column, error) {
+	if keys == "" {
+		return columns, nil
+	}
+	result := make([]Column, 0)
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(keys, ",") {
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate column %q", key)
+		}
+		seen[key] = true
+		found := false
+		for _, c := range columns {
+			if c.Key == key {
+				result = append(result, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid column %q", key)
+		}
+	}
+	return result, nil
+}
+
+// Writer writes depositories in a format
+type Writer interface {
+	Write(d *models.Depository) error
+	// Close completes the output. It doesn't close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a writer of format to w. Headers of csv and xlsx are written in style.
+func NewWriter(format Format, w io.Writer, columns []Column, style depositories.Style) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns, style)
+	case FormatNDJSON:
+		return newNDJSONWriter(w, columns), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns, style)
+	}
+	return nil, fmt.Errorf("invalid format %q", format)
+}
+
+func labels(columns []Column, style depositories.Style) []string {
+	result := make([]string, 0, len(columns))
+	for _, c := range columns {
+		result = append(result, c.Label(style))
+	}
+	return result
+}
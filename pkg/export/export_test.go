@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/depositories"
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+func write(t *testing.T, format Format, columns []Column, style depositories.Style) []byte {
+	var b bytes.Buffer
+	w, err := NewWriter(format, &b, columns, style)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(&models.Depository{KID: "kid1", Name: `dep "1", <a>`, BlockNumber: 42}))
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+type sheet struct {
+	Rows []struct {
+		Cells []struct {
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readSheet reads the worksheet of a xlsx file
+func readSheet(t *testing.T, raw []byte) sheet {
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 5)
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	require.NoError(t, err)
+	var result sheet
+	require.NoError(t, xml.NewDecoder(f).Decode(&result))
+	return result
+}
+
+// TestWriters tests exporting depositories in each format
+func TestWriters(t *testing.T) {
+	columns, err := Columns("kid,name,blockNumber")
+	require.NoError(t, err)
+	_, err = Columns("kid,nmae")
+	assert.Error(t, err)
+	_, err = NewWriter("pdf", io.Discard, columns, depositories.StyleCN)
+	assert.Error(t, err)
+
+	assert.Equal(t, "\xef\xbb\xbf存证ID,存证名称,区块高度\nkid1,\"dep \"\"1\"\", <a>\",42\n", string(write(t, FormatCSV, columns, depositories.StyleCN)))
+	assert.Equal(t, `{"kid":"kid1","name":"dep \"1\", \u003ca\u003e","blockNumber":42}`+"\n", string(write(t, FormatNDJSON, columns, depositories.StyleENG)))
+
+	sheet := readSheet(t, write(t, FormatXLSX, columns, depositories.StyleENG))
+	require.Len(t, sheet.Rows, 2)
+	assert.Equal(t, "Block Number", sheet.Rows[0].Cells[2].Inline)
+	assert.Equal(t, `dep "1", <a>`, sheet.Rows[1].Cells[1].Inline)
+	assert.Equal(t, "42", sheet.Rows[1].Cells[2].Value)
+}
+
+// TestEscapeFormula tests text which starts a formula is exported as text in csv, and as is
+// in xlsx where it is never run
+func TestEscapeFormula(t *testing.T) {
+	for _, s := range []string{"=HYPERLINK(\"http://x\")", "+1", "-1+2", "@SUM(A1)", "\t=1"} {
+		assert.Equal(t, "'"+s, escapeFormula(s))
+	}
+	for _, s := range []string{"", "dep 1", "1=1"} {
+		assert.Equal(t, s, escapeFormula(s))
+	}
+
+	columns, err := Columns("name,blockNumber")
+	require.NoError(t, err)
+	var b bytes.Buffer
+	w, err := NewWriter(FormatCSV, &b, columns, depositories.StyleENG)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(&models.Depository{Name: "=1+1", BlockNumber: 42}))
+	require.NoError(t, w.Close())
+	assert.Equal(t, "\xef\xbb\xbfName,Block Number\n'=1+1,42\n", b.String())
+
+	b.Reset()
+	w, err = NewWriter(FormatXLSX, &b, columns, depositories.StyleENG)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(&models.Depository{Name: "-1+1", BlockNumber: 42}))
+	require.NoError(t, w.Close())
+	sheet := readSheet(t, b.Bytes())
+	require.Len(t, sheet.Rows, 2)
+	assert.Equal(t, "-1+1", sheet.Rows[1].Cells[0].Inline)
+}
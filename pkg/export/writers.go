@@ -0,0 +1,216 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/bestchains/bc-saas/pkg/depositories"
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []Column
+}
+
+func newCSVWriter(w io.Writer, columns []Column, style depositories.Style) (Writer, error) {
+	// byte order mark, so Excel opens Chinese text as utf-8
+	if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+		return nil, err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(labels(columns, style)); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw, columns: columns}, nil
+}
+
+func (cw *csvWriter) Write(d *models.Depository) error {
+	record := make([]string, 0, len(cw.columns))
+	for _, c := range cw.columns {
+		switch v := c.Value(d).(type) {
+		case int64, uint64:
+			record = append(record, fmt.Sprint(v))
+		default:
+			record = append(record, escapeFormula(fmt.Sprint(v)))
+		}
+	}
+	return cw.w.Write(record)
+}
+
+// escapeFormula prefixes text which spreadsheets would run as a formula with a quote,
+// as values of depositories are supplied by anyone
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []Column
+	buf     bytes.Buffer
+}
+
+func newNDJSONWriter(w io.Writer, columns []Column) Writer {
+	return &ndjsonWriter{w: w, columns: columns}
+}
+
+// Write writes a json object of columns in order
+func (nw *ndjsonWriter) Write(d *models.Depository) error {
+	nw.buf.Reset()
+	nw.buf.WriteByte('{')
+	for i, c := range nw.columns {
+		if i > 0 {
+			nw.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(c.Key)
+		value, err := json.Marshal(c.Value(d))
+		if err != nil {
+			return err
+		}
+		nw.buf.Write(key)
+		nw.buf.WriteByte(':')
+		nw.buf.Write(value)
+	}
+	nw.buf.WriteString("}\n")
+	_, err := nw.w.Write(nw.buf.Bytes())
+	return err
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+const (
+	// limits of a worksheet
+	xlsxMaxRows       = 1048576
+	xlsxMaxCellLength = 32767
+)
+
+// xlsx parts besides the worksheet
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="depositories" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// xlsxWriter writes a workbook of one worksheet. Rows are written into the zip stream
+// as inline strings and numbers, so nothing is held in memory.
+type xlsxWriter struct {
+	zw      *zip.Writer
+	sheet   io.Writer
+	columns []Column
+	rows    int
+}
+
+func newXLSXWriter(w io.Writer, columns []Column, style depositories.Style) (Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw := &xlsxWriter{zw: zw, sheet: sheet, columns: columns}
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+	header := make([]interface{}, 0, len(columns))
+	for _, label := range labels(columns, style) {
+		header = append(header, label)
+	}
+	return xw, xw.writeRow(header)
+}
+
+func (xw *xlsxWriter) Write(d *models.Depository) error {
+	values := make([]interface{}, 0, len(xw.columns))
+	for _, c := range xw.columns {
+		values = append(values, c.Value(d))
+	}
+	return xw.writeRow(values)
+}
+
+func (xw *xlsxWriter) writeRow(values []interface{}) error {
+	if xw.rows >= xlsxMaxRows {
+		return errors.Errorf("more than %d rows in a xlsx worksheet", xlsxMaxRows)
+	}
+	xw.rows++
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<row r="%d">`, xw.rows)
+	for _, v := range values {
+		switch v := v.(type) {
+		case int64, uint64:
+			fmt.Fprintf(&b, `<c><v>%d</v></c>`, v)
+		default:
+			// inline strings are never run as formulas
+			s := fmt.Sprint(v)
+			if utf8.RuneCountInString(s) > xlsxMaxCellLength {
+				s = string([]rune(s)[:xlsxMaxCellLength])
+			}
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			// invalid xml characters are replaced
+			if err := xml.EscapeText(&b, []byte(s)); err != nil {
+				return err
+			}
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+	_, err := xw.sheet.Write(b.Bytes())
+	return err
+}
+
+func (xw *xlsxWriter) Close() error {
+	if _, err := io.WriteString(xw.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
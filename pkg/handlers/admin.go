@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// Admins are users allowed to see depositories hidden by moderation
+type Admins struct {
+	Users  []string
+	Groups []string
+	// RestrictList only allows admins to list and export all depositories
+	RestrictList bool
+}
+
+// Contains returns true if u is an admin. u is nil when authentication is disabled,
+// and nobody is an admin then.
+func (admins Admins) Contains(u user.Info) bool {
+	if u == nil {
+		return false
+	}
+	for _, name := range admins.Users {
+		if name == u.GetName() {
+			return true
+		}
+	}
+	for _, group := range u.GetGroups() {
+		for _, admin := range admins.Groups {
+			if admin == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Visibility makes depositories hidden by moderation only visible to admins
+func (admins Admins) Visibility(u user.Info, d *models.Depository) bool {
+	return d.Moderation != models.ModerationHidden || admins.Contains(u)
+}
+
+// Guard only passes requests of admins, which protects admin routes
+func (admins Admins) Guard(ctx *fiber.Ctx) error {
+	if !admins.isAdmin(ctx) {
+		ctx.Status(http.StatusForbidden)
+		return ctx.JSON(map[string]string{
+			"msg": "only admins are allowed",
+		})
+	}
+	return ctx.Next()
+}
+
+// GuardList only passes requests of admins if RestrictList, which protects routes over all depositories
+func (admins Admins) GuardList(ctx *fiber.Ctx) error {
+	if admins.RestrictList && !admins.isAdmin(ctx) {
+		return forbidList(ctx)
+	}
+	return ctx.Next()
+}
+
+// forbidList responds that only admins can list all depositories
+func forbidList(ctx *fiber.Ctx) error {
+	ctx.Status(http.StatusForbidden)
+	return ctx.JSON(map[string]string{
+		"msg": "only admins can list all depositories, see /basic/me/depositories",
+	})
+}
+
+// isAdmin returns true if the user of request ctx is an admin
+func (admins Admins) isAdmin(ctx *fiber.Ctx) bool {
+	u, _ := request.UserFrom(ctx.Context())
+	return admins.Contains(u)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/gofiber/adaptor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// TestAdmins_Guard tests only admins pass, and nobody is an admin without authentication.
+// Routes over all depositories are only guarded with RestrictList.
+func TestAdmins_Guard(t *testing.T) {
+	admins := Admins{Users: []string{"alice"}, Groups: []string{"ops"}}
+	app := fiber.New()
+	// authenticates the user in header X-User, in group X-Group, the same way as auth middlewares
+	app.Use(adaptor.HTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if name := r.Header.Get("X-User"); name != "" {
+				u := &user.DefaultInfo{Name: name, Groups: []string{r.Header.Get("X-Group")}}
+				r = r.WithContext(request.WithUser(r.Context(), u))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}))
+	ok := func(ctx *fiber.Ctx) error {
+		return ctx.SendString("ok")
+	}
+	app.Group("admin", admins.Guard).Get("leader", ok)
+	app.Get("basic/stats", admins.GuardList, ok)
+	restricted := admins
+	restricted.RestrictList = true
+	app.Get("basic/transactions", restricted.GuardList, ok)
+
+	for _, c := range []struct {
+		path, user, group string
+		status            int
+	}{
+		{"/admin/leader", "", "", http.StatusForbidden},
+		{"/admin/leader", "bob", "", http.StatusForbidden},
+		{"/admin/leader", "alice", "", http.StatusOK},
+		{"/admin/leader", "bob", "ops", http.StatusOK},
+		{"/basic/stats", "", "", http.StatusOK},
+		{"/basic/transactions", "bob", "", http.StatusForbidden},
+		{"/basic/transactions", "alice", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req.Header.Set("X-User", c.user)
+		req.Header.Set("X-Group", c.group)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, c.status, resp.StatusCode, c)
+	}
+}
+
+// TestAdmins_Visibility tests depositories hidden by moderation are only streamed to admins
+func TestAdmins_Visibility(t *testing.T) {
+	admins := Admins{Users: []string{"alice"}}
+	hidden := &models.Depository{KID: "kid1", Moderation: models.ModerationHidden}
+	disputed := &models.Depository{KID: "kid2", Moderation: models.ModerationDisputed}
+
+	assert.True(t, admins.Visibility(&user.DefaultInfo{Name: "alice"}, hidden))
+	assert.False(t, admins.Visibility(&user.DefaultInfo{Name: "bob"}, hidden))
+	assert.False(t, admins.Visibility(nil, hidden))
+	assert.True(t, admins.Visibility(&user.DefaultInfo{Name: "bob"}, disputed))
+}
@@ -17,13 +17,17 @@ limitations under the License.
 package handler
 
 import (
+	"bufio"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 
 	"github.com/bestchains/bc-saas/pkg/contracts"
 	"github.com/bestchains/bc-saas/pkg/depositories"
+	"github.com/bestchains/bc-saas/pkg/export"
 	"github.com/bestchains/bc-saas/pkg/utils"
 	"github.com/go-pg/pg/v10"
 	"github.com/gofiber/fiber/v2"
@@ -63,12 +67,15 @@ type VerifyStatus struct {
 type BasicHandler struct {
 	contractClient *contracts.Depository
 	dbHandler      depositories.Interface
+	// admins also see depositories hidden by moderation
+	admins Admins
 }
 
-func NewBasicHandler(contractClient *contracts.Depository, h depositories.Interface) BasicHandler {
+func NewBasicHandler(contractClient *contracts.Depository, h depositories.Interface, admins Admins) BasicHandler {
 	return BasicHandler{
 		contractClient: contractClient,
 		dbHandler:      h,
+		admins:         admins,
 	}
 }
 
@@ -237,17 +244,25 @@ func (h *BasicHandler) List(ctx *fiber.Ctx) error {
 	klog.Info("BasicHandler List Depositories")
 	klog.V(5).Infof(" with ctx %+v\n", *ctx)
 
-	arg := depositories.DepositoryCond{
-		From:        ctx.QueryInt("from", 0),
-		Size:        ctx.QueryInt("size", 10),
-		StartTime:   int64(ctx.QueryInt("startTime", 0)),
-		EndTime:     int64(ctx.QueryInt("endTime", 0)),
-		Name:        ctx.Query("name"),
-		KID:         ctx.Query("kid"),
-		ContentName: ctx.Query("contentName", ""),
+	if h.admins.RestrictList && !h.admins.isAdmin(ctx) {
+		return forbidList(ctx)
 	}
+	return h.list(ctx, nil)
+}
+
+// list responds depositories of accounts matching query. All accounts if nil
+func (h *BasicHandler) list(ctx *fiber.Ctx, accounts []string) error {
+	arg, err := parseDepositoryCond(ctx)
+	if err != nil {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	arg.Accounts = accounts
+	arg.IncludeHidden = h.admins.isAdmin(ctx)
 
-	result, count, err := h.dbHandler.List(arg)
+	page, err := h.dbHandler.List(arg)
 	if err != nil {
 		klog.Errorf("[Error] list depositories error %s", err)
 		ctx.Status(http.StatusInternalServerError)
@@ -256,12 +271,94 @@ func (h *BasicHandler) List(ctx *fiber.Ctx) error {
 		})
 	}
 	data := map[string]interface{}{
-		"data":  result,
-		"count": count,
+		"data": page.Data,
+	}
+	if page.Count >= 0 {
+		data["count"] = page.Count
+	}
+	if page.Next != nil {
+		data["next"] = pageLink(ctx, page.Next)
+	}
+	if page.Prev != nil {
+		data["prev"] = pageLink(ctx, page.Prev)
 	}
 	return ctx.JSON(data)
 }
 
+// pageLink returns the link of the current request at cursor
+func pageLink(ctx *fiber.Ctx, cursor *depositories.Cursor) string {
+	query, _ := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	query.Del("from")
+	query.Set("cursor", cursor.Encode())
+	return ctx.Path() + "?" + query.Encode()
+}
+
+// exportParams are query parameters of exporting depositories besides filters
+var exportParams = map[string]bool{
+	"format": true, "columns": true, "style": true, "sort": true,
+}
+
+// Export streams all depositories matching filters as csv, ndjson or xlsx
+func (h *BasicHandler) Export(ctx *fiber.Ctx) error {
+	klog.Info("BasicHandler Export Depositories")
+	klog.V(5).Infof(" with ctx %+v\n", *ctx)
+
+	if h.admins.RestrictList && !h.admins.isAdmin(ctx) {
+		return forbidList(ctx)
+	}
+
+	badRequest := func(err error) error {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	if err := checkQueryParams(ctx, depositoryFilterParams, exportParams); err != nil {
+		return badRequest(err)
+	}
+	arg, err := parseDepositoryFilter(ctx)
+	if err != nil {
+		return badRequest(err)
+	}
+	if arg.Sort, err = depositories.ParseSort(ctx.Query("sort")); err != nil {
+		return badRequest(err)
+	}
+	arg.IncludeHidden = h.admins.isAdmin(ctx)
+	columns, err := export.Columns(ctx.Query("columns"))
+	if err != nil {
+		return badRequest(err)
+	}
+	format := export.Format(ctx.Query("format", string(export.FormatCSV)))
+	style := depositories.Style(ctx.Query("style", depositories.StyleCN))
+	if _, ok := depositories.CertificateStyles[style]; !ok {
+		return badRequest(fmt.Errorf("invalid style %s", style))
+	}
+	// validate format before streaming
+	if _, err := export.NewWriter(format, io.Discard, columns, style); err != nil {
+		return badRequest(err)
+	}
+
+	ctx.Set("Content-Type", format.ContentType())
+	ctx.Set("Content-Disposition", fmt.Sprintf("attachment; filename=depositories.%s", format))
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// status is sent already. A broken export is only logged and truncated
+		writer, err := export.NewWriter(format, w, columns, style)
+		if err == nil {
+			err = h.dbHandler.Export(arg, writer.Write)
+			if closeErr := writer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			klog.Errorf("[Error] export depositories error %s", err)
+		}
+	})
+	return nil
+}
+
 func (h *BasicHandler) Get(ctx *fiber.Ctx) error {
 	klog.Info("BasicHandler Get Depository")
 	klog.V(5).Infof(" with ctx %+v\n", *ctx)
@@ -273,7 +370,7 @@ func (h *BasicHandler) Get(ctx *fiber.Ctx) error {
 			"msg": "kid can't be empty",
 		})
 	}
-	arg := depositories.DepositoryCond{KID: kid}
+	arg := depositories.DepositoryCond{KID: kid, IncludeHidden: h.admins.isAdmin(ctx)}
 	result, err := h.dbHandler.Get(arg)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
@@ -300,12 +397,14 @@ func (h *BasicHandler) GetDepositoryCertificate(ctx *fiber.Ctx) error {
 		})
 	}
 	style := ctx.Query("style")
-	arg := depositories.DepositoryCond{KID: kid}
+	arg := depositories.DepositoryCond{KID: kid, IncludeHidden: h.admins.isAdmin(ctx)}
 	certBytes, err := h.dbHandler.GetCertificate(arg, depositories.Style(style))
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		if err == pg.ErrNoRows {
 			ctx.Status(http.StatusNotFound)
+		} else if err == depositories.ErrDisputed {
+			ctx.Status(http.StatusForbidden)
 		}
 		klog.Errorf("[Error] Get certificate for %s error %s", kid, err)
 		return ctx.JSON(map[string]string{
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// DeadLetters manages chaincode events which failed to be handled
+type DeadLetters interface {
+	List(status models.DeadLetterStatus, from, size int) ([]models.DeadLetter, int64, error)
+	Get(id int64) (models.DeadLetter, error)
+	Replay(ctx context.Context, id int64) (models.DeadLetter, error)
+	Discard(id int64) (models.DeadLetter, error)
+}
+
+type DeadLetterHandler struct {
+	deadLetters DeadLetters
+}
+
+func NewDeadLetterHandler(deadLetters DeadLetters) DeadLetterHandler {
+	return DeadLetterHandler{
+		deadLetters: deadLetters,
+	}
+}
+
+func (h *DeadLetterHandler) List(ctx *fiber.Ctx) error {
+	klog.Info("DeadLetterHandler List Dead Letters")
+	klog.V(5).Infof(" with ctx %+v\n", *ctx)
+
+	result, count, err := h.deadLetters.List(
+		models.DeadLetterStatus(ctx.Query("status")),
+		ctx.QueryInt("from", 0),
+		ctx.QueryInt("size", 10),
+	)
+	if err != nil {
+		klog.Errorf("[Error] list dead letters error %s", err)
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	return ctx.JSON(map[string]interface{}{
+		"data":  result,
+		"count": count,
+	})
+}
+
+func (h *DeadLetterHandler) Get(ctx *fiber.Ctx) error {
+	return h.do(ctx, "get", func(id int64) (models.DeadLetter, error) {
+		return h.deadLetters.Get(id)
+	})
+}
+
+// Replay handles a dead letter right now. Result is recorded in the returned dead letter.
+func (h *DeadLetterHandler) Replay(ctx *fiber.Ctx) error {
+	return h.do(ctx, "replay", func(id int64) (models.DeadLetter, error) {
+		return h.deadLetters.Replay(ctx.Context(), id)
+	})
+}
+
+func (h *DeadLetterHandler) Discard(ctx *fiber.Ctx) error {
+	return h.do(ctx, "discard", h.deadLetters.Discard)
+}
+
+func (h *DeadLetterHandler) do(ctx *fiber.Ctx, action string, f func(id int64) (models.DeadLetter, error)) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{
+			"msg": "invalid id",
+		})
+	}
+	result, err := f(int64(id))
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		switch err {
+		case pg.ErrNoRows:
+			ctx.Status(http.StatusNotFound)
+		case models.ErrDeadLetterNotReplayable:
+			ctx.Status(http.StatusConflict)
+		}
+		klog.Errorf("[Error] %s dead letter %d error %s", action, id, err)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	return ctx.JSON(result)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/bestchains/bc-saas/pkg/depositories"
+)
+
+// depositoryFilterParams are query parameters to filter depositories.
+// Unknown ones are rejected, so a typo doesn't silently select everything.
+var depositoryFilterParams = map[string]bool{
+	"q": true, "name": true, "kid": true, "contentName": true, "startTime": true, "endTime": true,
+	"owner": true, "operator": true, "platform": true, "contentType": true, "contentID": true, "transactionID": true,
+	"minBlockNumber": true, "maxBlockNumber": true, "minContentSize": true, "maxContentSize": true,
+}
+
+// depositoryPageParams are query parameters to page listed depositories
+var depositoryPageParams = map[string]bool{
+	"from": true, "size": true, "cursor": true, "count": true, "sort": true,
+}
+
+// checkQueryParams rejects query parameters not in any of allowed
+func checkQueryParams(ctx *fiber.Ctx, allowed ...map[string]bool) error {
+	var err error
+	ctx.Context().QueryArgs().VisitAll(func(key, _ []byte) {
+		for _, params := range allowed {
+			if params[string(key)] {
+				return
+			}
+		}
+		if err == nil {
+			err = fmt.Errorf("unknown query parameter %s", key)
+		}
+	})
+	return err
+}
+
+// queryParser parses query parameters and keeps the first error
+type queryParser struct {
+	ctx *fiber.Ctx
+	err error
+}
+
+func (p *queryParser) int64(key string) *int64 {
+	value := p.ctx.Query(key)
+	if value == "" || p.err != nil {
+		return nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v < 0 {
+		p.err = fmt.Errorf("invalid %s %q", key, value)
+		return nil
+	}
+	return &v
+}
+
+func (p *queryParser) uint64(key string) *uint64 {
+	v := p.int64(key)
+	if v == nil {
+		return nil
+	}
+	u := uint64(*v)
+	return &u
+}
+
+func (p *queryParser) int(key string, defaultValue int) int {
+	v := p.int64(key)
+	if v == nil {
+		return defaultValue
+	}
+	return int(*v)
+}
+
+// parseDepositoryCond parses and validates query parameters of listing depositories
+func parseDepositoryCond(ctx *fiber.Ctx) (depositories.DepositoryCond, error) {
+	if err := checkQueryParams(ctx, depositoryFilterParams, depositoryPageParams); err != nil {
+		return depositories.DepositoryCond{}, err
+	}
+	arg, err := parseDepositoryFilter(ctx)
+	if err != nil {
+		return arg, err
+	}
+
+	p := &queryParser{ctx: ctx}
+	arg.From = p.int("from", 0)
+	arg.Size = p.int("size", 10)
+	if p.err != nil {
+		return arg, p.err
+	}
+	arg.Count = depositories.CountMode(ctx.Query("count", string(depositories.CountExact)))
+	switch arg.Count {
+	case depositories.CountExact, depositories.CountEstimate, depositories.CountNone:
+	default:
+		return arg, fmt.Errorf("invalid count %q", arg.Count)
+	}
+	if arg.Sort, err = depositories.ParseSort(ctx.Query("sort")); err != nil {
+		return arg, err
+	}
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		if arg.Q != "" || len(arg.Sort) > 0 {
+			return arg, fmt.Errorf("cursor can't be used with q or sort")
+		}
+		if arg.Cursor, err = depositories.ParseCursor(cursor); err != nil {
+			return arg, err
+		}
+	}
+	return arg, nil
+}
+
+// parseDepositoryFilter parses and validates query parameters which filter depositories
+func parseDepositoryFilter(ctx *fiber.Ctx) (depositories.DepositoryCond, error) {
+	p := &queryParser{ctx: ctx}
+	arg := depositories.DepositoryCond{
+		Name:           ctx.Query("name"),
+		KID:            ctx.Query("kid"),
+		ContentName:    ctx.Query("contentName"),
+		Q:              ctx.Query("q"),
+		Owner:          ctx.Query("owner"),
+		Operator:       ctx.Query("operator"),
+		Platform:       ctx.Query("platform"),
+		ContentType:    ctx.Query("contentType"),
+		ContentID:      ctx.Query("contentID"),
+		TransactionID:  ctx.Query("transactionID"),
+		MinBlockNumber: p.uint64("minBlockNumber"),
+		MaxBlockNumber: p.uint64("maxBlockNumber"),
+		MinContentSize: p.int64("minContentSize"),
+		MaxContentSize: p.int64("maxContentSize"),
+	}
+	if v := p.int64("startTime"); v != nil {
+		arg.StartTime = *v
+	}
+	if v := p.int64("endTime"); v != nil {
+		arg.EndTime = *v
+	}
+	if p.err != nil {
+		return arg, p.err
+	}
+
+	if arg.EndTime > 0 && arg.StartTime > arg.EndTime {
+		return arg, fmt.Errorf("startTime is after endTime")
+	}
+	if arg.MinBlockNumber != nil && arg.MaxBlockNumber != nil && *arg.MinBlockNumber > *arg.MaxBlockNumber {
+		return arg, fmt.Errorf("minBlockNumber is greater than maxBlockNumber")
+	}
+	if arg.MinContentSize != nil && arg.MaxContentSize != nil && *arg.MinContentSize > *arg.MaxContentSize {
+		return arg, fmt.Errorf("minContentSize is greater than maxContentSize")
+	}
+	return arg, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/contracts"
+	"github.com/bestchains/bc-saas/pkg/depositories"
+	"github.com/bestchains/bc-saas/pkg/evidence"
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+type EvidenceHandler struct {
+	contractClient *contracts.Depository
+	dbHandler      depositories.Interface
+	builder        *evidence.Builder
+}
+
+func NewEvidenceHandler(contractClient *contracts.Depository, h depositories.Interface, builder *evidence.Builder) EvidenceHandler {
+	return EvidenceHandler{
+		contractClient: contractClient,
+		dbHandler:      h,
+		builder:        builder,
+	}
+}
+
+// GetEvidence exports a signed evidence bundle of a depository which can be verified offline
+func (h *EvidenceHandler) GetEvidence(ctx *fiber.Ctx) error {
+	klog.Info("EvidenceHandler Get Evidence")
+	klog.V(5).Infof(" with ctx %+v\n", *ctx)
+
+	kid := ctx.Params("kid")
+	if kid == "" {
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{
+			"msg": "kid can't be empty",
+		})
+	}
+	depository, err := h.dbHandler.Get(depositories.DepositoryCond{KID: kid})
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		if err == pg.ErrNoRows {
+			ctx.Status(http.StatusNotFound)
+		}
+		klog.Errorf("[Error] Get %s error %s", kid, err)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	if depository.TransactionID == "" {
+		ctx.Status(http.StatusNotFound)
+		return ctx.JSON(map[string]string{
+			"msg": "transaction of depository not found",
+		})
+	}
+	value, err := h.contractClient.GetValueByKID(kid)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	bundle, err := h.builder.Build(kid, value, depository.TransactionID)
+	if err != nil {
+		klog.Errorf("[Error] Build evidence for %s error %s", kid, err)
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	raw, err := json.Marshal(bundle)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	ctx.Response().Header.Add("Content-Type", "application/json")
+	ctx.Response().Header.Add("Content-Disposition", fmt.Sprintf("attachment; filename=%s.evidence.json", kid))
+	return ctx.Send(raw)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListenerStater reports state of the chaincode event listener
+type ListenerStater interface {
+	State() models.ListenerState
+}
+
+type ListenerHandler struct {
+	listener ListenerStater
+}
+
+func NewListenerHandler(listener ListenerStater) ListenerHandler {
+	return ListenerHandler{
+		listener: listener,
+	}
+}
+
+// GetState returns connection state and checkpoint of the event listener
+func (handler *ListenerHandler) GetState(ctx *fiber.Ctx) error {
+	return ctx.JSON(handler.listener.State())
+}
+
+// LeaderStater reports state of leader election
+type LeaderStater interface {
+	State() models.LeaderState
+}
+
+type LeaderHandler struct {
+	elector LeaderStater
+}
+
+func NewLeaderHandler(elector LeaderStater) LeaderHandler {
+	return LeaderHandler{
+		elector: elector,
+	}
+}
+
+// GetState returns whether this replica is the leader which ingests events
+func (handler *LeaderHandler) GetState(ctx *fiber.Ctx) error {
+	return ctx.JSON(handler.elector.State())
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/accounts"
+	"github.com/bestchains/bc-saas/pkg/utils"
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/klog/v2"
+)
+
+// BindArgs defines request fields of binding an account
+type BindArgs struct {
+	// Message is a base64 encoded utils.Message signed over the name of the authenticated user
+	Message string `json:"message"`
+}
+
+// MeHandler serves depositories of the authenticated user, which are owned or operated
+// by accounts bound to the user
+type MeHandler struct {
+	registry *accounts.Registry
+	basic    *BasicHandler
+	stats    *StatsHandler
+}
+
+func NewMeHandler(registry *accounts.Registry, basic *BasicHandler, stats *StatsHandler) MeHandler {
+	return MeHandler{
+		registry: registry,
+		basic:    basic,
+		stats:    stats,
+	}
+}
+
+// Depositories lists depositories of the authenticated user with the same query as GET /basic/depositories
+func (h *MeHandler) Depositories(ctx *fiber.Ctx) error {
+	addresses, err := h.addresses(ctx)
+	if err != nil {
+		return h.error(ctx, "list my depositories", err)
+	}
+	return h.basic.list(ctx, addresses)
+}
+
+// Stats returns the number and total content size of depositories of the authenticated user
+func (h *MeHandler) Stats(ctx *fiber.Ctx) error {
+	addresses, err := h.addresses(ctx)
+	if err != nil {
+		return h.error(ctx, "get my stats", err)
+	}
+	return h.stats.summary(ctx, addresses)
+}
+
+// ListAccounts lists accounts bound to the authenticated user
+func (h *MeHandler) ListAccounts(ctx *fiber.Ctx) error {
+	user, err := h.user(ctx)
+	if err != nil {
+		return h.error(ctx, "list my accounts", err)
+	}
+	result, err := h.registry.List(user)
+	if err != nil {
+		return h.error(ctx, "list my accounts", err)
+	}
+	return ctx.JSON(map[string]interface{}{
+		"data":  result,
+		"count": len(result),
+	})
+}
+
+// BindAccount binds the account which signed the message to the authenticated user
+func (h *MeHandler) BindAccount(ctx *fiber.Ctx) error {
+	user, err := h.user(ctx)
+	if err != nil {
+		return h.error(ctx, "bind account", err)
+	}
+	args := new(BindArgs)
+	if err := ctx.BodyParser(args); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	msg := &utils.Message{}
+	if err := msg.UnmarshalBase64Str(args.Message); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	binding, err := h.registry.Bind(user, msg)
+	if err != nil {
+		return h.error(ctx, "bind account", err)
+	}
+	klog.Infof("Account %s is bound to %s", binding.Address, user)
+	return ctx.Status(http.StatusCreated).JSON(binding)
+}
+
+// UnbindAccount unbinds an account from the authenticated user
+func (h *MeHandler) UnbindAccount(ctx *fiber.Ctx) error {
+	user, err := h.user(ctx)
+	if err != nil {
+		return h.error(ctx, "unbind account", err)
+	}
+	if err := h.registry.Unbind(user, ctx.Params("address")); err != nil {
+		return h.error(ctx, "unbind account", err)
+	}
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// errUnauthenticated is returned if no user is authenticated, such as with -auth none
+var errUnauthenticated = errors.New("unauthenticated")
+
+// user returns the name of the authenticated user
+func (h *MeHandler) user(ctx *fiber.Ctx) (string, error) {
+	u, ok := request.UserFrom(ctx.Context())
+	if !ok || u.GetName() == "" {
+		return "", errUnauthenticated
+	}
+	return u.GetName(), nil
+}
+
+// addresses returns addresses of accounts bound to the authenticated user
+func (h *MeHandler) addresses(ctx *fiber.Ctx) ([]string, error) {
+	user, err := h.user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.registry.Addresses(user)
+}
+
+func (h *MeHandler) error(ctx *fiber.Ctx, action string, err error) error {
+	ctx.Status(http.StatusInternalServerError)
+	switch {
+	case err == errUnauthenticated:
+		ctx.Status(http.StatusUnauthorized)
+	case err == pg.ErrNoRows:
+		ctx.Status(http.StatusNotFound)
+	case errors.Is(err, accounts.ErrInvalidProof):
+		ctx.Status(http.StatusBadRequest)
+	case errors.Is(err, accounts.ErrBound):
+		ctx.Status(http.StatusConflict)
+	}
+	klog.Errorf("[Error] %s error %s", action, err)
+	return ctx.JSON(map[string]string{
+		"msg": err.Error(),
+	})
+}
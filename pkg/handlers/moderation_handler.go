@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/moderation"
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/klog/v2"
+)
+
+// FlagArgs defines request fields of a moderation flag
+type FlagArgs struct {
+	Status models.ModerationStatus `json:"status"`
+	Reason string                  `json:"reason"`
+}
+
+type ModerationHandler struct {
+	moderator *moderation.Moderator
+}
+
+func NewModerationHandler(moderator *moderation.Moderator) ModerationHandler {
+	return ModerationHandler{
+		moderator: moderator,
+	}
+}
+
+// Flag a depository as hidden, disputed or restored
+func (h *ModerationHandler) Flag(ctx *fiber.Ctx) error {
+	args := new(FlagArgs)
+	if err := ctx.BodyParser(args); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	// the operator is always the authenticated user, so flags can be audited
+	operator := ""
+	if u, ok := request.UserFrom(ctx.Context()); ok {
+		operator = u.GetName()
+	}
+	kid := ctx.Params("kid")
+	flag, err := h.moderator.Flag(kid, args.Status, args.Reason, operator)
+	if err != nil {
+		return h.error(ctx, "flag depository", err)
+	}
+	klog.Infof("Depository %s is %s by %s: %s", kid, flag.Status, flag.Operator, flag.Reason)
+	return ctx.Status(http.StatusCreated).JSON(flag)
+}
+
+// List moderated depositories
+func (h *ModerationHandler) List(ctx *fiber.Ctx) error {
+	result, count, err := h.moderator.List(
+		models.ModerationStatus(ctx.Query("status")),
+		ctx.QueryInt("from", 0),
+		ctx.QueryInt("size", 10),
+	)
+	if err != nil {
+		return h.error(ctx, "list moderations", err)
+	}
+	return ctx.JSON(map[string]interface{}{
+		"data":  result,
+		"count": count,
+	})
+}
+
+// Get the current moderation of a depository with its audit flags
+func (h *ModerationHandler) Get(ctx *fiber.Ctx) error {
+	kid := ctx.Params("kid")
+	flags, count, err := h.moderator.ListFlags(kid, ctx.QueryInt("from", 0), ctx.QueryInt("size", 10))
+	if err != nil {
+		return h.error(ctx, "list moderation flags", err)
+	}
+	data := map[string]interface{}{
+		"flags": flags,
+		"count": count,
+	}
+	current, err := h.moderator.Get(kid)
+	switch {
+	case err == nil:
+		data["moderation"] = current
+	case err != pg.ErrNoRows:
+		return h.error(ctx, "get moderation", err)
+	}
+	return ctx.JSON(data)
+}
+
+func (h *ModerationHandler) error(ctx *fiber.Ctx, action string, err error) error {
+	ctx.Status(http.StatusInternalServerError)
+	if err == pg.ErrNoRows {
+		ctx.Status(http.StatusNotFound)
+	} else if errors.Is(err, moderation.ErrInvalidFlag) {
+		ctx.Status(http.StatusBadRequest)
+	}
+	klog.Errorf("[Error] %s error %s", action, err)
+	return ctx.JSON(map[string]string{
+		"msg": err.Error(),
+	})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// Reconciler compares the depository index with ledger
+type Reconciler interface {
+	Report() (models.ReconcileReport, bool)
+	Reconcile(ctx context.Context, repair bool) (models.ReconcileReport, error)
+}
+
+type ReconcileHandler struct {
+	reconciler Reconciler
+}
+
+func NewReconcileHandler(reconciler Reconciler) ReconcileHandler {
+	return ReconcileHandler{
+		reconciler: reconciler,
+	}
+}
+
+// GetReport returns the report of the last reconciliation
+func (h *ReconcileHandler) GetReport(ctx *fiber.Ctx) error {
+	report, ok := h.reconciler.Report()
+	if !ok {
+		ctx.Status(http.StatusNotFound)
+		return ctx.JSON(map[string]string{
+			"msg": "no reconciliation yet",
+		})
+	}
+	return ctx.JSON(report)
+}
+
+// Reconcile compares the index with ledger now. Missing depositories are repaired with query repair=true
+func (h *ReconcileHandler) Reconcile(ctx *fiber.Ctx) error {
+	klog.Info("ReconcileHandler Reconcile")
+	report, err := h.reconciler.Reconcile(ctx.Context(), ctx.QueryBool("repair", false))
+	if err != nil {
+		klog.Errorf("[Error] reconcile error %s", err)
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	return ctx.JSON(report)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// Reindexer rebuilds the depository index from ledger
+type Reindexer interface {
+	Start(fromBlock uint64) (models.ReindexJob, error)
+	List(from, size int) ([]models.ReindexJob, int64, error)
+	Get(id int64) (models.ReindexJob, error)
+	Cancel(id int64) (models.ReindexJob, error)
+}
+
+// ReindexArgs to start a reindex job
+type ReindexArgs struct {
+	// FromBlock is the first block to replay
+	FromBlock uint64 `json:"fromBlock"`
+}
+
+type ReindexHandler struct {
+	reindexer Reindexer
+}
+
+func NewReindexHandler(reindexer Reindexer) ReindexHandler {
+	return ReindexHandler{
+		reindexer: reindexer,
+	}
+}
+
+// Start resumes the unfinished reindex job, or starts a new one
+func (h *ReindexHandler) Start(ctx *fiber.Ctx) error {
+	klog.Info("ReindexHandler Start")
+	args := new(ReindexArgs)
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(args); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+	job, err := h.reindexer.Start(args.FromBlock)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		if err == models.ErrReindexRunning {
+			ctx.Status(http.StatusConflict)
+		}
+		klog.Errorf("[Error] start reindex error %s", err)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	ctx.Status(http.StatusAccepted)
+	return ctx.JSON(job)
+}
+
+func (h *ReindexHandler) List(ctx *fiber.Ctx) error {
+	klog.Info("ReindexHandler List Jobs")
+	result, count, err := h.reindexer.List(ctx.QueryInt("from", 0), ctx.QueryInt("size", 10))
+	if err != nil {
+		klog.Errorf("[Error] list reindex jobs error %s", err)
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	return ctx.JSON(map[string]interface{}{
+		"data":  result,
+		"count": count,
+	})
+}
+
+// Get returns progress of a reindex job
+func (h *ReindexHandler) Get(ctx *fiber.Ctx) error {
+	return h.do(ctx, "get", h.reindexer.Get)
+}
+
+// Cancel stops a reindex job and drops its table
+func (h *ReindexHandler) Cancel(ctx *fiber.Ctx) error {
+	return h.do(ctx, "cancel", h.reindexer.Cancel)
+}
+
+func (h *ReindexHandler) do(ctx *fiber.Ctx, action string, f func(id int64) (models.ReindexJob, error)) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{
+			"msg": "invalid id",
+		})
+	}
+	result, err := f(int64(id))
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		switch err {
+		case pg.ErrNoRows:
+			ctx.Status(http.StatusNotFound)
+		case models.ErrReindexFinished:
+			ctx.Status(http.StatusConflict)
+		}
+		klog.Errorf("[Error] %s reindex job %d error %s", action, id, err)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	return ctx.JSON(result)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/cache"
+	"github.com/bestchains/bc-saas/pkg/depositories"
+)
+
+const (
+	defaultBreakdownLimit = 10
+	maxBreakdownLimit     = 1000
+)
+
+// statsParams are query parameters of statistics besides filters
+var statsParams = map[string]bool{
+	"interval": true, "tz": true, "by": true, "limit": true,
+}
+
+// StatsHandler serves statistics of depositories. Results are cached, as aggregating
+// all depositories is heavy.
+type StatsHandler struct {
+	dbHandler depositories.Interface
+	cache     *cache.LRU
+}
+
+func NewStatsHandler(h depositories.Interface, cache *cache.LRU) StatsHandler {
+	return StatsHandler{
+		dbHandler: h,
+		cache:     cache,
+	}
+}
+
+// Summary returns the number and total content size of depositories
+func (h *StatsHandler) Summary(ctx *fiber.Ctx) error {
+	return h.summary(ctx, nil)
+}
+
+// summary responds the number and total content size of depositories of accounts. All accounts if nil
+func (h *StatsHandler) summary(ctx *fiber.Ctx, accounts []string) error {
+	return h.stats(ctx, accounts, func(opts *depositories.StatsOptions) error {
+		return nil
+	}, func(buckets []depositories.StatsBucket) interface{} {
+		summary := depositories.StatsBucket{}
+		if len(buckets) > 0 {
+			summary = buckets[0]
+		}
+		return summary
+	})
+}
+
+// Timeline returns statistics of depositories bucketed by day, week or month of trustedTimestamp
+func (h *StatsHandler) Timeline(ctx *fiber.Ctx) error {
+	interval := depositories.Group(ctx.Query("interval", string(depositories.GroupDay)))
+	return h.stats(ctx, nil, func(opts *depositories.StatsOptions) error {
+		if !interval.IsTime() {
+			return fmt.Errorf("invalid interval %q", interval)
+		}
+		loc, err := time.LoadLocation(ctx.Query("tz", "UTC"))
+		if err != nil || loc == time.Local {
+			return fmt.Errorf("invalid tz %q", ctx.Query("tz"))
+		}
+		opts.Group, opts.Location = interval, loc
+		return nil
+	}, func(buckets []depositories.StatsBucket) interface{} {
+		return map[string]interface{}{
+			"interval": interval,
+			"data":     buckets,
+		}
+	})
+}
+
+// Breakdown returns statistics of depositories by owner, platform or contentType, the most first
+func (h *StatsHandler) Breakdown(ctx *fiber.Ctx) error {
+	by := depositories.Group(ctx.Query("by", string(depositories.GroupOwner)))
+	return h.stats(ctx, nil, func(opts *depositories.StatsOptions) error {
+		if !by.IsBreakdown() {
+			return fmt.Errorf("invalid by %q", by)
+		}
+		p := &queryParser{ctx: ctx}
+		limit := p.int("limit", defaultBreakdownLimit)
+		if p.err != nil || limit < 1 || limit > maxBreakdownLimit {
+			return fmt.Errorf("invalid limit %q, which should be 1 to %d", ctx.Query("limit"), maxBreakdownLimit)
+		}
+		opts.Group, opts.Limit = by, limit
+		return nil
+	}, func(buckets []depositories.StatsBucket) interface{} {
+		return map[string]interface{}{
+			"by":   by,
+			"data": buckets,
+		}
+	})
+}
+
+// stats responds statistics of filtered depositories of accounts with options set by options
+func (h *StatsHandler) stats(ctx *fiber.Ctx, accounts []string, options func(opts *depositories.StatsOptions) error, response func([]depositories.StatsBucket) interface{}) error {
+	klog.Infof("StatsHandler %s", ctx.Path())
+	klog.V(5).Infof(" with ctx %+v\n", *ctx)
+
+	// query is encoded in order of keys, so the same one hits cache whatever the order is
+	query, _ := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	key := ctx.Path() + "?" + query.Encode()
+	if accounts != nil {
+		key += "#" + strings.Join(accounts, ",")
+	}
+	if cached, ok := h.cache.Get(key); ok {
+		return ctx.JSON(cached)
+	}
+
+	arg, err := parseStatsFilter(ctx)
+	if err != nil {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	arg.Accounts = accounts
+	opts := depositories.StatsOptions{}
+	if err := options(&opts); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	buckets, err := h.dbHandler.Stats(arg, opts)
+	if err != nil {
+		klog.Errorf("[Error] aggregate depositories error %s", err)
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	result := response(buckets)
+	h.cache.Set(key, result)
+	return ctx.JSON(result)
+}
+
+func parseStatsFilter(ctx *fiber.Ctx) (depositories.DepositoryCond, error) {
+	if err := checkQueryParams(ctx, depositoryFilterParams, statsParams); err != nil {
+		return depositories.DepositoryCond{}, err
+	}
+	return parseDepositoryFilter(ctx)
+}
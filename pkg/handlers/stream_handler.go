@@ -0,0 +1,199 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bestchains/bc-saas/pkg/accounts"
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/stream"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/klog/v2"
+)
+
+const (
+	localStreamFilter = "streamFilter"
+	localStreamFrom   = "streamFrom"
+
+	wsWriteTimeout = 10 * time.Second
+	// websocket close code asking clients to reconnect later
+	wsCloseTryAgainLater = 1013
+)
+
+// StreamMessage is an event sent over websocket
+type StreamMessage struct {
+	ID    string             `json:"id"`
+	Event string             `json:"event"`
+	Data  *models.Depository `json:"data"`
+}
+
+// StreamHandler streams depositories visible to the authenticated user, the same as listing them
+type StreamHandler struct {
+	broker *stream.Broker
+	admins Admins
+	// registry of accounts bound to users, optional
+	registry *accounts.Registry
+}
+
+func NewStreamHandler(broker *stream.Broker, admins Admins, registry *accounts.Registry) StreamHandler {
+	return StreamHandler{
+		broker:   broker,
+		admins:   admins,
+		registry: registry,
+	}
+}
+
+// filter parses filters and resume position of a stream request
+func (h *StreamHandler) filter(ctx *fiber.Ctx) (stream.Filter, *stream.Position, error) {
+	filter := stream.Filter{
+		Owner:      ctx.Query("owner"),
+		Platform:   ctx.Query("platform"),
+		KID:        ctx.Query("kid"),
+		Visibility: h.admins.Visibility,
+	}
+	if u, ok := request.UserFrom(ctx.Context()); ok {
+		filter.User = u
+	}
+	// others only see depositories of their bound accounts if listing all is restricted
+	if h.admins.RestrictList && !h.admins.Contains(filter.User) {
+		filter.Accounts = []string{}
+		if h.registry != nil && filter.User != nil && filter.User.GetName() != "" {
+			addresses, err := h.registry.Addresses(filter.User.GetName())
+			if err != nil {
+				klog.Errorf("[Error] list accounts of %s error %s", filter.User.GetName(), err)
+				return filter, nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+			}
+			filter.Accounts = addresses
+		}
+	}
+
+	// browsers can't set headers on the first connection, so query is also accepted
+	lastEventID := ctx.Get("Last-Event-ID", ctx.Query("lastEventID"))
+	if lastEventID == "" {
+		return filter, nil, nil
+	}
+	from, err := stream.ParsePosition(lastEventID)
+	if err != nil {
+		return filter, nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err = h.broker.CheckBacklog(ctx.Context(), filter, from); err != nil {
+		if err == stream.ErrBacklogTooLarge {
+			return filter, nil, fiber.NewError(fiber.StatusBadRequest, err.Error()+", list them with /basic/depositories instead")
+		}
+		klog.Errorf("[Error] check backlog after %s error %s", lastEventID, err)
+		return filter, nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return filter, &from, nil
+}
+
+// Stream serves indexed depositories as Server-Sent Events
+func (h *StreamHandler) Stream(ctx *fiber.Ctx) error {
+	klog.Info("StreamHandler Stream")
+	filter, from, err := h.filter(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+	// disable buffering of nginx
+	ctx.Set("X-Accel-Buffering", "no")
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		sctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+		err := h.broker.Stream(sctx, filter, from, func(e *stream.Event) error {
+			if e == nil {
+				fmt.Fprint(w, ": ping\n\n")
+				return w.Flush()
+			}
+			data, err := json.Marshal(e.Depository)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			return w.Flush()
+		})
+		if err != nil {
+			klog.V(5).Infof("[Debug] Event stream closed: %s", err)
+		}
+	})
+	return nil
+}
+
+// Upgrade accepts websocket connections of event stream
+func (h *StreamHandler) Upgrade(ctx *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+	filter, from, err := h.filter(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Locals(localStreamFilter, filter)
+	ctx.Locals(localStreamFrom, from)
+	return ctx.Next()
+}
+
+// WebSocket serves indexed depositories as StreamMessage over websocket.
+// It must be used after Upgrade.
+func (h *StreamHandler) WebSocket(conn *websocket.Conn) {
+	klog.Info("StreamHandler WebSocket")
+	filter, _ := conn.Locals(localStreamFilter).(stream.Filter)
+	from, _ := conn.Locals(localStreamFrom).(*stream.Position)
+
+	sctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// messages from clients are ignored. Reading is required to notice closed connections
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err := h.broker.Stream(sctx, filter, from, func(e *stream.Event) error {
+		if e == nil {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		}
+		if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(&StreamMessage{ID: e.ID, Event: e.Type, Data: e.Depository})
+	})
+	if err == stream.ErrSlowSubscriber {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(wsCloseTryAgainLater, err.Error()), time.Now().Add(wsWriteTimeout))
+		return
+	}
+	if err != nil {
+		klog.V(5).Infof("[Debug] Event stream closed: %s", err)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bestchains/bc-saas/pkg/transactions"
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+type TransactionHandler struct {
+	dbHandler transactions.Interface
+}
+
+func NewTransactionHandler(h transactions.Interface) TransactionHandler {
+	return TransactionHandler{
+		dbHandler: h,
+	}
+}
+
+// List transactions of the contract, including invalid ones
+func (h *TransactionHandler) List(ctx *fiber.Ctx) error {
+	klog.Info("TransactionHandler List Transactions")
+	klog.V(5).Infof(" with ctx %+v\n", *ctx)
+
+	arg := transactions.TransactionCond{
+		From:           ctx.QueryInt("from", 0),
+		Size:           ctx.QueryInt("size", 10),
+		StartTime:      int64(ctx.QueryInt("startTime", 0)),
+		EndTime:        int64(ctx.QueryInt("endTime", 0)),
+		TransactionID:  ctx.Query("transactionID"),
+		CreatorMSP:     ctx.Query("creatorMSP"),
+		Function:       ctx.Query("function"),
+		ValidationCode: ctx.Query("validationCode"),
+	}
+	if valid := ctx.Query("valid"); valid != "" {
+		v, err := strconv.ParseBool(valid)
+		if err != nil {
+			ctx.Status(http.StatusBadRequest)
+			return ctx.JSON(map[string]string{
+				"msg": "invalid valid " + valid,
+			})
+		}
+		arg.Valid = &v
+	}
+
+	result, count, err := h.dbHandler.List(arg)
+	if err != nil {
+		klog.Errorf("[Error] list transactions error %s", err)
+		ctx.Status(http.StatusInternalServerError)
+		return ctx.JSON(map[string]string{
+			"msg": err.Error(),
+		})
+	}
+	data := map[string]interface{}{
+		"data":  result,
+		"count": count,
+	}
+	return ctx.JSON(data)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/webhooks"
+	"github.com/go-pg/pg/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// WebhookArgs defines request fields of a webhook subscription
+type WebhookArgs struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"eventTypes"`
+	Owner      string   `json:"owner"`
+	// Active defaults to true on creation, and is kept on update if not provided
+	Active *bool `json:"active,omitempty"`
+}
+
+func (args *WebhookArgs) toSubscription(active bool) *models.WebhookSubscription {
+	if args.Active != nil {
+		active = *args.Active
+	}
+	return &models.WebhookSubscription{
+		URL:        args.URL,
+		Secret:     args.Secret,
+		EventTypes: args.EventTypes,
+		Owner:      args.Owner,
+		Active:     active,
+	}
+}
+
+type WebhookHandler struct {
+	dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhookHandler(dispatcher *webhooks.Dispatcher) WebhookHandler {
+	return WebhookHandler{
+		dispatcher: dispatcher,
+	}
+}
+
+// Create a subscription. The secret is only returned here.
+func (h *WebhookHandler) Create(ctx *fiber.Ctx) error {
+	args := new(WebhookArgs)
+	if err := ctx.BodyParser(args); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	s := args.toSubscription(true)
+	if err := h.dispatcher.CreateSubscription(s); err != nil {
+		return h.error(ctx, "create webhook", err)
+	}
+	return ctx.Status(http.StatusCreated).JSON(s)
+}
+
+func (h *WebhookHandler) List(ctx *fiber.Ctx) error {
+	result, err := h.dispatcher.ListSubscriptions()
+	if err != nil {
+		return h.error(ctx, "list webhooks", err)
+	}
+	return ctx.JSON(map[string]interface{}{
+		"data":  result,
+		"count": len(result),
+	})
+}
+
+func (h *WebhookHandler) Get(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	result, err := h.dispatcher.GetSubscription(int64(id))
+	if err != nil {
+		return h.error(ctx, "get webhook", err)
+	}
+	return ctx.JSON(result)
+}
+
+// Update a subscription. Secret is kept if not provided.
+func (h *WebhookHandler) Update(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	args := new(WebhookArgs)
+	if err := ctx.BodyParser(args); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	current, err := h.dispatcher.GetSubscription(int64(id))
+	if err != nil {
+		return h.error(ctx, "get webhook", err)
+	}
+	s := args.toSubscription(current.Active)
+	s.ID = current.ID
+	if err := h.dispatcher.UpdateSubscription(s); err != nil {
+		return h.error(ctx, "update webhook", err)
+	}
+	result, err := h.dispatcher.GetSubscription(s.ID)
+	if err != nil {
+		return h.error(ctx, "get webhook", err)
+	}
+	return ctx.JSON(result)
+}
+
+func (h *WebhookHandler) Delete(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	if err := h.dispatcher.DeleteSubscription(int64(id)); err != nil {
+		return h.error(ctx, "delete webhook", err)
+	}
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// ListDeliveries of a subscription
+func (h *WebhookHandler) ListDeliveries(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	result, count, err := h.dispatcher.ListDeliveries(
+		int64(id),
+		models.WebhookDeliveryStatus(ctx.Query("status")),
+		ctx.QueryInt("from", 0),
+		ctx.QueryInt("size", 10),
+	)
+	if err != nil {
+		return h.error(ctx, "list webhook deliveries", err)
+	}
+	return ctx.JSON(map[string]interface{}{
+		"data":  result,
+		"count": count,
+	})
+}
+
+// ListAttempts of a delivery with their response codes
+func (h *WebhookHandler) ListAttempts(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	result, err := h.dispatcher.ListAttempts(int64(id))
+	if err != nil {
+		return h.error(ctx, "list webhook attempts", err)
+	}
+	return ctx.JSON(map[string]interface{}{
+		"data":  result,
+		"count": len(result),
+	})
+}
+
+// Redeliver a delivery as soon as possible
+func (h *WebhookHandler) Redeliver(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	result, err := h.dispatcher.Redeliver(int64(id))
+	if err != nil {
+		return h.error(ctx, "redeliver webhook delivery", err)
+	}
+	return ctx.JSON(result)
+}
+
+func (h *WebhookHandler) error(ctx *fiber.Ctx, action string, err error) error {
+	ctx.Status(http.StatusInternalServerError)
+	if err == pg.ErrNoRows {
+		ctx.Status(http.StatusNotFound)
+	} else if errors.Is(err, webhooks.ErrInvalidSubscription) {
+		ctx.Status(http.StatusBadRequest)
+	}
+	klog.Errorf("[Error] %s error %s", action, err)
+	return ctx.JSON(map[string]string{
+		"msg": err.Error(),
+	})
+}
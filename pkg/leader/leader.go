@@ -0,0 +1,194 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leader elects a leader among replicas sharing a database
+package leader
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+const (
+	// retryPeriod to acquire leadership
+	retryPeriod = 2 * time.Second
+	// checkPeriod of the connection which holds the lock
+	checkPeriod  = 2 * time.Second
+	checkTimeout = 5 * time.Second
+)
+
+var isLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "bc_saas",
+	Name:      "leader",
+	Help:      "Whether this replica is the leader which ingests events",
+})
+
+func init() {
+	prometheus.MustRegister(isLeader)
+}
+
+// Elector elects a leader with a postgres session level advisory lock. The lock is held by a
+// dedicated connection and released by postgres as soon as the connection is closed, so another
+// replica takes over once the leader dies.
+type Elector struct {
+	db       *pg.DB
+	key      int64
+	identity string
+	// checkPeriod of the connection which holds the lock
+	checkPeriod time.Duration
+
+	mu    sync.RWMutex
+	state models.LeaderState
+}
+
+// NewElector creates an elector of replicas which use the same name
+func NewElector(db *pg.DB, name string, identity string) *Elector {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return &Elector{
+		db:          db,
+		key:         int64(h.Sum64()),
+		identity:    identity,
+		checkPeriod: checkPeriod,
+		state: models.LeaderState{
+			Identity: identity,
+			Since:    time.Now().Unix(),
+		},
+	}
+}
+
+// State returns the election state of this replica
+func (e *Elector) State() models.LeaderState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.state
+}
+
+func (e *Elector) setLeader(leader bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.state.LastError = err.Error()
+	}
+	if e.state.Leader == leader {
+		return
+	}
+	e.state.Leader = leader
+	e.state.Since = time.Now().Unix()
+	e.state.Transitions++
+	if leader {
+		isLeader.Set(1)
+	} else {
+		isLeader.Set(0)
+	}
+}
+
+// Run campaigns until ctx is done. lead is called once this replica becomes the leader, and
+// its context is cancelled when leadership is lost. lead should return after that.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		conn := e.db.Conn()
+		acquired, err := e.acquire(ctx, conn)
+		if err != nil {
+			klog.Errorf("[Error] acquire leadership error %s", err)
+			e.setLeader(false, err)
+		}
+		if acquired {
+			klog.Infof("[Success] %s became the leader", e.identity)
+			e.setLeader(true, nil)
+			err = e.lead(ctx, conn, lead)
+			e.setLeader(false, err)
+			klog.Infof("%s lost leadership: %v", e.identity, err)
+		}
+		// closing the connection releases the lock anyway
+		conn.Close()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryPeriod):
+		}
+	}
+}
+
+// acquire tries to take the lock with conn
+func (e *Elector) acquire(ctx context.Context, conn *pg.Conn) (bool, error) {
+	// detect a dead leader host in about 10s instead of the system default of hours
+	for _, set := range []string{
+		"SET tcp_keepalives_idle = 4",
+		"SET tcp_keepalives_interval = 2",
+		"SET tcp_keepalives_count = 3",
+	} {
+		if _, err := conn.ExecContext(ctx, set); err != nil {
+			return false, errors.Wrap(err, "set keepalives")
+		}
+	}
+	var acquired bool
+	if _, err := conn.QueryOneContext(ctx, pg.Scan(&acquired), "SELECT pg_try_advisory_lock(?)", e.key); err != nil {
+		return false, errors.Wrap(err, "try advisory lock")
+	}
+	return acquired, nil
+}
+
+// execer is the connection which holds the lock, implemented by *pg.Conn
+type execer interface {
+	ExecContext(ctx context.Context, query interface{}, params ...interface{}) (orm.Result, error)
+}
+
+// lead runs lead until ctx is done or conn which holds the lock is broken
+func (e *Elector) lead(ctx context.Context, conn execer, lead func(ctx context.Context)) error {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	ticker := time.NewTicker(e.checkPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			unlockCtx, cancelUnlock := context.WithTimeout(context.Background(), checkTimeout)
+			defer cancelUnlock()
+			_, _ = conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock(?)", e.key)
+			return ctx.Err()
+		case <-done:
+			return errors.New("leader stopped")
+		case <-ticker.C:
+			checkCtx, cancelCheck := context.WithTimeout(ctx, checkTimeout)
+			_, err := conn.ExecContext(checkCtx, "SELECT 1")
+			cancelCheck()
+			if err != nil && ctx.Err() == nil {
+				return errors.Wrap(err, "check lock connection")
+			}
+		}
+	}
+}
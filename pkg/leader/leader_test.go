@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn fails checks of the lock once broken
+type fakeConn struct {
+	mu      sync.Mutex
+	broken  bool
+	queries []string
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query interface{}, params ...interface{}) (orm.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, query.(string))
+	if c.broken {
+		return nil, errors.New("connection reset")
+	}
+	return nil, nil
+}
+
+func (c *fakeConn) Queries() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.queries...)
+}
+
+func newTestElector() *Elector {
+	e := NewElector(nil, "test", "replica-0")
+	e.checkPeriod = 10 * time.Millisecond
+	return e
+}
+
+func TestElector_setLeader(t *testing.T) {
+	e := newTestElector()
+	e.setLeader(true, nil)
+	e.setLeader(true, nil)
+	state := e.State()
+	assert.True(t, state.Leader)
+	assert.Equal(t, 1, state.Transitions)
+
+	e.setLeader(false, errors.New("check lock connection"))
+	state = e.State()
+	assert.False(t, state.Leader)
+	assert.Equal(t, 2, state.Transitions)
+	assert.Equal(t, "check lock connection", state.LastError)
+
+	// a failed campaign of a follower is not a transition
+	e.setLeader(false, errors.New("try advisory lock"))
+	state = e.State()
+	assert.Equal(t, 2, state.Transitions)
+	assert.Equal(t, "try advisory lock", state.LastError)
+}
+
+// TestElector_lead tests leadership is lost once the lock connection breaks, the leader stops
+// or ctx is done, and lead always returns after its context is cancelled
+func TestElector_lead(t *testing.T) {
+	e := newTestElector()
+
+	t.Run("broken connection", func(t *testing.T) {
+		conn := &fakeConn{}
+		stopped := make(chan struct{})
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			conn.mu.Lock()
+			conn.broken = true
+			conn.mu.Unlock()
+		}()
+		err := e.lead(context.Background(), conn, func(ctx context.Context) {
+			<-ctx.Done()
+			close(stopped)
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "check lock connection")
+		<-stopped
+	})
+
+	t.Run("leader stopped", func(t *testing.T) {
+		err := e.lead(context.Background(), &fakeConn{}, func(ctx context.Context) {})
+		require.Error(t, err)
+		assert.Equal(t, "leader stopped", err.Error())
+	})
+
+	t.Run("ctx done", func(t *testing.T) {
+		conn := &fakeConn{}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := e.lead(ctx, conn, func(ctx context.Context) { <-ctx.Done() })
+		assert.Equal(t, context.DeadlineExceeded, err)
+		queries := conn.Queries()
+		require.NotEmpty(t, queries)
+		assert.Equal(t, "SELECT pg_advisory_unlock(?)", queries[len(queries)-1])
+	})
+}
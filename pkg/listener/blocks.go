@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/bestchains/bc-saas/pkg/utils"
+	"github.com/go-pg/pg/v10"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+)
+
+// blockCheckpointSuffix distinguishes checkpoints of block listeners from chaincode event listeners
+const blockCheckpointSuffix = "/blocks"
+
+// SubscribeBlocks subscribes blocks from startBlock.
+// The returned channel is closed when ctx is done or the stream is broken.
+type SubscribeBlocks func(ctx context.Context, startBlock uint64) (<-chan *common.Block, error)
+
+// blockListener indexes every transaction of a contract in blocks, including invalid ones
+type blockListener struct {
+	contract  string
+	subscribe SubscribeBlocks
+
+	db           *pg.DB
+	checkpointer *Checkpointer
+
+	// subscription lifecycle and state
+	subscription
+}
+
+func NewBlockListener(db *pg.DB, channel string, contract string, subscribe SubscribeBlocks) (Listener, error) {
+	if db == nil || contract == "" || subscribe == nil {
+		return nil, errors.New("invalid arguments")
+	}
+	checkpointer, err := NewCheckpointer(db, channel, contract+blockCheckpointSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return &blockListener{
+		contract:     contract,
+		subscribe:    subscribe,
+		db:           db,
+		checkpointer: checkpointer,
+		subscription: newSubscription(),
+	}, nil
+}
+
+// State returns the current state of subscription
+func (l *blockListener) State() models.ListenerState {
+	state := l.subscription.State()
+	state.BlockNumber = l.checkpointer.BlockNumber()
+	return state
+}
+
+// Events subscribes blocks and indexes them until ctx is done
+func (l *blockListener) Events(ctx context.Context) {
+	klog.Info("starting fetch blocks")
+	l.run(ctx, l.consume)
+}
+
+// consume subscribes once from the checkpoint and indexes blocks until the stream is closed
+// or a block fails to be indexed. It reports whether any block is received.
+func (l *blockListener) consume(ctx context.Context) (bool, error) {
+	l.setStatus(models.ListenerConnecting, nil)
+	if err := l.checkpointer.Reload(l.db); err != nil {
+		return false, err
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	blocks, err := l.subscribe(subCtx, l.checkpointer.BlockNumber())
+	if err != nil {
+		return false, errors.Wrap(err, "subscribe blocks")
+	}
+	l.setStatus(models.ListenerConnected, nil)
+	klog.Infof("subscribed blocks from block %d", l.checkpointer.BlockNumber())
+
+	received := false
+	for block := range blocks {
+		received = true
+		if err = l.index(ctx, block); err != nil {
+			// resubscribe from this block
+			return received, errors.Wrapf(err, "index block %d", block.GetHeader().GetNumber())
+		}
+	}
+	return received, nil
+}
+
+// index stores transactions of contract in block with the checkpoint of block
+func (l *blockListener) index(ctx context.Context, block *common.Block) error {
+	txs := ContractTransactions(block, l.contract)
+	var checkpoint models.Checkpoint
+	err := l.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if len(txs) > 0 {
+			// transactions of a block indexed again after resubscribing are skipped
+			if _, err := tx.Model(&txs).OnConflict(`("blockNumber", "txIndex") DO NOTHING`).Insert(); err != nil {
+				return errors.Wrap(err, "insert transactions")
+			}
+		}
+		var err error
+		checkpoint, err = l.checkpointer.SaveBlock(tx, block.GetHeader().GetNumber())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	l.checkpointer.Commit(checkpoint)
+	if len(txs) > 0 {
+		klog.Infof("[Success] index %d transactions in block %d", len(txs), block.GetHeader().GetNumber())
+	}
+	return nil
+}
+
+// ContractTransactions returns all endorser transactions which invoke contract in block
+func ContractTransactions(block *common.Block, contract string) []models.Transaction {
+	txs := make([]models.Transaction, 0)
+	for i, data := range block.GetData().GetData() {
+		env := &common.Envelope{}
+		if err := proto.Unmarshal(data, env); err != nil {
+			klog.Errorf("[Error] unmarshal envelope %d in block %d: %s", i, block.GetHeader().GetNumber(), err)
+			continue
+		}
+		tx, err := utils.ParseChaincodeTransaction(env)
+		if err != nil {
+			if err != utils.ErrNotEndorserTransaction {
+				klog.Errorf("[Error] parse transaction %d in block %d: %s", i, block.GetHeader().GetNumber(), err)
+			}
+			continue
+		}
+		if tx.ChaincodeName != contract {
+			continue
+		}
+		code := utils.TxValidationCode(block, i)
+		txs = append(txs, models.Transaction{
+			TransactionID:  tx.ChannelHeader.GetTxId(),
+			BlockNumber:    block.GetHeader().GetNumber(),
+			TxIndex:        i,
+			CreatorMSP:     tx.Creator.GetMspid(),
+			Function:       tx.Function(),
+			ValidationCode: code.String(),
+			Valid:          code == peer.TxValidationCode_VALID,
+			Timestamp:      tx.ChannelHeader.GetTimestamp().GetSeconds(),
+		})
+	}
+	return txs
+}
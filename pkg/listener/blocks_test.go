@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func marshal(t *testing.T, m proto.Message) []byte {
+	result, err := proto.Marshal(m)
+	require.NoError(t, err)
+	return result
+}
+
+// testEnvelope returns a transaction txID which invokes function of contract
+func testEnvelope(t *testing.T, txID string, contract string, function string) []byte {
+	invocation := &peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: contract},
+		Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte(function)}},
+	}}
+	actionPayload := &peer.ChaincodeActionPayload{
+		ChaincodeProposalPayload: marshal(t, &peer.ChaincodeProposalPayload{Input: marshal(t, invocation)}),
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: marshal(t, &peer.ProposalResponsePayload{
+				Extension: marshal(t, &peer.ChaincodeAction{ChaincodeId: &peer.ChaincodeID{Name: contract}}),
+			}),
+		},
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   marshal(t, &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: txID}),
+			SignatureHeader: marshal(t, &common.SignatureHeader{}),
+		},
+		Data: marshal(t, &peer.Transaction{Actions: []*peer.TransactionAction{{Payload: marshal(t, actionPayload)}}}),
+	}
+	return marshal(t, &common.Envelope{Payload: marshal(t, payload)})
+}
+
+// TestContractTransactions tests transactions with a duplicated id are kept at their positions
+func TestContractTransactions(t *testing.T) {
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 7},
+		Data: &common.BlockData{Data: [][]byte{
+			testEnvelope(t, "tx1", "depository", "PutValue"),
+			testEnvelope(t, "tx2", "market", "PutValue"),
+			testEnvelope(t, "tx1", "depository", "PutValue"),
+		}},
+		Metadata: &common.BlockMetadata{Metadata: make([][]byte, len(common.BlockMetadataIndex_name))},
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = []byte{
+		byte(peer.TxValidationCode_VALID),
+		byte(peer.TxValidationCode_VALID),
+		byte(peer.TxValidationCode_DUPLICATE_TXID),
+	}
+
+	txs := ContractTransactions(block, "depository")
+	require.Len(t, txs, 2)
+	assert.Equal(t, "tx1", txs[0].TransactionID)
+	assert.Equal(t, 0, txs[0].TxIndex)
+	assert.True(t, txs[0].Valid)
+	assert.Equal(t, "PutValue", txs[0].Function)
+	assert.Equal(t, "tx1", txs[1].TransactionID)
+	assert.Equal(t, uint64(7), txs[1].BlockNumber)
+	assert.Equal(t, 2, txs[1].TxIndex)
+	assert.Equal(t, "DUPLICATE_TXID", txs[1].ValidationCode)
+	assert.False(t, txs[1].Valid)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+var _ client.Checkpoint = (*Checkpointer)(nil)
+
+// Checkpointer persists the last processed chaincode event of a contract,
+// so listener resumes right after it with client.WithCheckpoint.
+type Checkpointer struct {
+	mu         sync.RWMutex
+	checkpoint models.Checkpoint
+}
+
+// NewCheckpointer loads the checkpoint of contract in channel. A zero checkpoint is
+// returned if no event has been processed.
+func NewCheckpointer(db *pg.DB, channel string, contract string) (*Checkpointer, error) {
+	c := &Checkpointer{
+		checkpoint: models.Checkpoint{Channel: channel, Contract: contract},
+	}
+	err := db.Model(&c.checkpoint).WherePK().Select()
+	if err != nil && err != pg.ErrNoRows {
+		return nil, errors.Wrap(err, "load checkpoint")
+	}
+	return c, nil
+}
+
+// Reload loads the checkpoint from db, which may have been saved by another replica
+func (c *Checkpointer) Reload(db *pg.DB) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkpoint := models.Checkpoint{Channel: c.checkpoint.Channel, Contract: c.checkpoint.Contract}
+	err := db.Model(&checkpoint).WherePK().Select()
+	if err != nil && err != pg.ErrNoRows {
+		return errors.Wrap(err, "reload checkpoint")
+	}
+	c.checkpoint = checkpoint
+	return nil
+}
+
+// BlockNumber in which the next event is expected
+func (c *Checkpointer) BlockNumber() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkpoint.BlockNumber
+}
+
+// TransactionID of the last processed event
+func (c *Checkpointer) TransactionID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkpoint.TransactionID
+}
+
+// Save persists event e as the last processed one with db, which should be the
+// transaction that also stores results of e. Call Commit once db is committed.
+func (c *Checkpointer) Save(db orm.DB, e *client.ChaincodeEvent) (models.Checkpoint, error) {
+	c.mu.RLock()
+	checkpoint := c.checkpoint
+	c.mu.RUnlock()
+
+	checkpoint.BlockNumber = e.BlockNumber
+	checkpoint.TransactionID = e.TransactionID
+	return c.save(db, checkpoint)
+}
+
+// SaveBlock persists block blockNumber as fully processed with db.
+// Call Commit once db is committed.
+func (c *Checkpointer) SaveBlock(db orm.DB, blockNumber uint64) (models.Checkpoint, error) {
+	c.mu.RLock()
+	checkpoint := c.checkpoint
+	c.mu.RUnlock()
+
+	checkpoint.BlockNumber = blockNumber + 1
+	checkpoint.TransactionID = ""
+	return c.save(db, checkpoint)
+}
+
+func (c *Checkpointer) save(db orm.DB, checkpoint models.Checkpoint) (models.Checkpoint, error) {
+	checkpoint.UpdatedAt = time.Now().Unix()
+	_, err := db.Model(&checkpoint).
+		OnConflict("(channel, contract) DO UPDATE").
+		Set(`"blockNumber" = EXCLUDED."blockNumber"`).
+		Set(`"transactionID" = EXCLUDED."transactionID"`).
+		Set(`"updatedAt" = EXCLUDED."updatedAt"`).
+		Insert()
+	if err != nil {
+		return checkpoint, errors.Wrap(err, "save checkpoint")
+	}
+	return checkpoint, nil
+}
+
+// Commit makes a saved checkpoint the current one
+func (c *Checkpointer) Commit(checkpoint models.Checkpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkpoint = checkpoint
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"time"
+
+	"github.com/bestchains/bc-saas/pkg/events"
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	retryInterval  = 10 * time.Second
+	retryBatchSize = 100
+	// retries of a dead letter are delayed from 30s to 1h
+	minRetryDelay = 30 * time.Second
+	maxRetryDelay = time.Hour
+	// maxAttempts before a dead letter is marked as failed
+	maxAttempts = 10
+)
+
+// DeadLetterQueue stores events which failed to be handled and retries them
+type DeadLetterQueue struct {
+	db       *pg.DB
+	contract string
+	// event registered and its handler
+	registeredEvents map[events.Event]events.EventHandler
+}
+
+func NewDeadLetterQueue(db *pg.DB, contract string, registeredEvents map[events.Event]events.EventHandler) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		db:               db,
+		contract:         contract,
+		registeredEvents: registeredEvents,
+	}
+}
+
+// Put stores event e which failed with handleErr. db should be the transaction
+// which also saves the checkpoint of e.
+func (q *DeadLetterQueue) Put(db orm.DB, e *client.ChaincodeEvent, handleErr error) error {
+	now := time.Now()
+	letter := &models.DeadLetter{
+		Contract:      q.contract,
+		EventName:     e.EventName,
+		BlockNumber:   e.BlockNumber,
+		TransactionID: e.TransactionID,
+		Payload:       e.Payload,
+		Status:        models.DeadLetterPending,
+		Error:         handleErr.Error(),
+		Attempts:      1,
+		NextRetryAt:   now.Add(retryDelay(1)).Unix(),
+		CreatedAt:     now.Unix(),
+		UpdatedAt:     now.Unix(),
+	}
+	if _, err := db.Model(letter).OnConflict("(\"transactionID\") DO NOTHING").Insert(); err != nil {
+		return errors.Wrap(err, "insert dead letter")
+	}
+	return nil
+}
+
+// List dead letters with status. All dead letters are listed if status is empty.
+func (q *DeadLetterQueue) List(status models.DeadLetterStatus, from, size int) ([]models.DeadLetter, int64, error) {
+	letters := make([]models.DeadLetter, 0)
+	query := q.db.Model(&letters).Order("id DESC").Offset(from).Limit(size)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	count, err := query.SelectAndCount()
+	return letters, int64(count), err
+}
+
+// Get a dead letter by id
+func (q *DeadLetterQueue) Get(id int64) (models.DeadLetter, error) {
+	letter := models.DeadLetter{ID: id}
+	err := q.db.Model(&letter).WherePK().Select()
+	return letter, err
+}
+
+// Replay handles a pending or failed dead letter right now.
+// Result of replay is recorded in the returned dead letter.
+func (q *DeadLetterQueue) Replay(ctx context.Context, id int64) (models.DeadLetter, error) {
+	if _, err := q.Get(id); err != nil {
+		return models.DeadLetter{}, err
+	}
+	if err := q.replay(ctx, id); err != nil {
+		if err == models.ErrDeadLetterNotReplayable {
+			return models.DeadLetter{}, err
+		}
+		klog.Errorf("[Error] replay dead letter %d: %s", id, err)
+	}
+	return q.Get(id)
+}
+
+// Discard a dead letter so it will never be handled
+func (q *DeadLetterQueue) Discard(id int64) (models.DeadLetter, error) {
+	if _, err := q.Get(id); err != nil {
+		return models.DeadLetter{}, err
+	}
+	result, err := q.db.Model((*models.DeadLetter)(nil)).
+		Set("status = ?", models.DeadLetterDiscarded).
+		Set(`"updatedAt" = ?`, time.Now().Unix()).
+		Where("id = ?", id).
+		Where("status IN (?, ?)", models.DeadLetterPending, models.DeadLetterFailed).
+		Update()
+	if err != nil {
+		return models.DeadLetter{}, err
+	}
+	if result.RowsAffected() == 0 {
+		return models.DeadLetter{}, models.ErrDeadLetterNotReplayable
+	}
+	return q.Get(id)
+}
+
+// Retry retries pending dead letters when they are due until ctx is done
+func (q *DeadLetterQueue) Retry(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ids := make([]int64, 0)
+			err := q.db.Model((*models.DeadLetter)(nil)).
+				Column("id").
+				Where("status = ?", models.DeadLetterPending).
+				Where(`"nextRetryAt" <= ?`, time.Now().Unix()).
+				Order("id ASC").
+				Limit(retryBatchSize).
+				Select(&ids)
+			if err != nil {
+				klog.Errorf("[Error] select dead letters to retry: %s", err)
+				continue
+			}
+			for _, id := range ids {
+				if err := q.replay(ctx, id); err != nil {
+					klog.Errorf("[Error] retry dead letter %d: %s", id, err)
+					continue
+				}
+				klog.Infof("[Success] dead letter %d resolved", id)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replay handles a dead letter and marks it as resolved in one transaction.
+// If handling fails again, the attempt is recorded and the handle error is returned.
+func (q *DeadLetterQueue) replay(ctx context.Context, id int64) error {
+	letter := models.DeadLetter{ID: id}
+	err := q.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// lock the dead letter so it is replayed only once
+		result, err := tx.Model(&letter).
+			Set("status = ?", models.DeadLetterResolved).
+			Set(`"updatedAt" = ?`, time.Now().Unix()).
+			WherePK().
+			Where("status IN (?, ?)", models.DeadLetterPending, models.DeadLetterFailed).
+			Returning("*").
+			Update()
+		if err == pg.ErrNoRows || (err == nil && result.RowsAffected() == 0) {
+			return models.ErrDeadLetterNotReplayable
+		}
+		if err != nil {
+			return err
+		}
+		eventHandler, ok := q.registeredEvents[events.Event(letter.EventName)]
+		if !ok {
+			return errors.Errorf("event %s not registered", letter.EventName)
+		}
+		commit, err := eventHandler(&client.ChaincodeEvent{
+			BlockNumber:   letter.BlockNumber,
+			TransactionID: letter.TransactionID,
+			ChaincodeName: letter.Contract,
+			EventName:     letter.EventName,
+			Payload:       letter.Payload,
+		})
+		if err != nil {
+			return err
+		}
+		return commit(tx)
+	})
+	if err == nil || err == models.ErrDeadLetterNotReplayable {
+		return err
+	}
+
+	// record this failed attempt
+	if letter, err2 := q.Get(id); err2 == nil {
+		now := time.Now()
+		letter.Attempts++
+		letter.Error = err.Error()
+		letter.NextRetryAt = now.Add(retryDelay(letter.Attempts)).Unix()
+		letter.UpdatedAt = now.Unix()
+		if letter.Attempts >= maxAttempts {
+			letter.Status = models.DeadLetterFailed
+		}
+		if _, err2 = q.db.Model(&letter).Column("attempts", "error", "nextRetryAt", "updatedAt", "status").WherePK().Update(); err2 != nil {
+			klog.Errorf("[Error] update dead letter %d: %s", id, err2)
+		}
+	}
+	return err
+}
+
+// retryDelay doubles from minRetryDelay on each attempt
+func retryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -16,8 +16,13 @@ limitations under the License.
 
 package listener
 
-import "context"
+import (
+	"context"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
 
 type Listener interface {
 	Events(context.Context)
+	State() models.ListenerState
 }
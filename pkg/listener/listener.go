@@ -18,27 +18,82 @@ package listener
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bestchains/bc-saas/pkg/events"
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/go-pg/pg/v10"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 )
 
-// listener listens chaincode events
+// Subscribe subscribes chaincode events right after checkpoint.
+// The returned channel is closed when ctx is done or the stream is broken.
+type Subscribe func(ctx context.Context, checkpoint client.Checkpoint) (<-chan *client.ChaincodeEvent, error)
+
+// PipelineConfig configures concurrent processing of events
+type PipelineConfig struct {
+	// Concurrency is the number of events prepared at the same time
+	Concurrency int
+	// QueueSize is the max number of received events waiting to be committed.
+	// Receiving from subscription blocks once it is full.
+	QueueSize int
+}
+
+// listener listens chaincode events.
+// Events are prepared concurrently, then committed one by one in the order they are received.
 type listener struct {
 	// event registered and its handler
 	registeredEvents map[events.Event]events.EventHandler
 
-	eventsSub <-chan *client.ChaincodeEvent
+	subscribe Subscribe
+	config    PipelineConfig
+
+	// db and checkpointer to commit results of an event together with its checkpoint
+	db           *pg.DB
+	checkpointer *Checkpointer
+	// deadLetters stores events failed to be handled
+	deadLetters *DeadLetterQueue
+
+	// queued is the number of events waiting to be committed
+	queued int64
+
+	// subscription lifecycle and state
+	subscription
+}
+
+// preparedEvent is an event prepared by its handler
+type preparedEvent struct {
+	event  *client.ChaincodeEvent
+	commit events.Commit
+	err    error
+}
+
+// job is an event to be prepared. Result is sent to the channel which is queued for commit.
+type job struct {
+	event  *client.ChaincodeEvent
+	result chan<- *preparedEvent
 }
 
-func NewListener(eventsSub <-chan *client.ChaincodeEvent, registeredEvents map[events.Event]events.EventHandler) (Listener, error) {
+func NewListener(db *pg.DB, checkpointer *Checkpointer, deadLetters *DeadLetterQueue, subscribe Subscribe, registeredEvents map[events.Event]events.EventHandler, config PipelineConfig) (Listener, error) {
+	if db == nil || checkpointer == nil || deadLetters == nil || subscribe == nil {
+		return nil, errors.New("invalid arguments")
+	}
+	if config.Concurrency <= 0 || config.QueueSize <= 0 {
+		return nil, errors.New("concurrency and queue size must be positive")
+	}
 	l := &listener{
-		eventsSub: eventsSub,
+		subscribe:    subscribe,
+		config:       config,
+		db:           db,
+		checkpointer: checkpointer,
+		deadLetters:  deadLetters,
+		subscription: newSubscription(),
 	}
 
-	l.eventsSub = eventsSub
-
 	// registeredEvents
 	if registeredEvents == nil {
 		registeredEvents = make(map[events.Event]events.EventHandler)
@@ -48,29 +103,157 @@ func NewListener(eventsSub <-chan *client.ChaincodeEvent, registeredEvents map[e
 	return l, nil
 }
 
+// State returns the current state of subscription
+func (l *listener) State() models.ListenerState {
+	state := l.subscription.State()
+	state.BlockNumber = l.checkpointer.BlockNumber()
+	state.TransactionID = l.checkpointer.TransactionID()
+	state.QueueDepth = atomic.LoadInt64(&l.queued)
+	return state
+}
+
+// Events subscribes chaincode events and handles them until ctx is done
 func (l *listener) Events(ctx context.Context) {
 	klog.Info("starting fetch events")
-	var err error
-	for {
-		select {
-		case e := <-l.eventsSub:
-			// check whether event registered
-			eventHandler, ok := l.registeredEvents[events.Event(e.EventName)]
-			if !ok {
-				klog.Warningf("Event %s not registered, skip", e.EventName)
-				continue
+	l.run(ctx, l.consume)
+}
+
+// consume subscribes once and handles events until the stream is closed or an event fails to be committed.
+// It reports whether any event is received.
+func (l *listener) consume(ctx context.Context) (bool, error) {
+	l.setStatus(models.ListenerConnecting, nil)
+	// events may have been committed by another replica which led before
+	if err := l.checkpointer.Reload(l.db); err != nil {
+		return false, err
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	eventsSub, err := l.subscribe(subCtx, l.checkpointer)
+	if err != nil {
+		return false, errors.Wrap(err, "subscribe events")
+	}
+	l.setStatus(models.ListenerConnected, nil)
+	klog.Infof("subscribed events after transaction %q in block %d", l.checkpointer.TransactionID(), l.checkpointer.BlockNumber())
+
+	return l.process(eventsSub, cancel, func(p *preparedEvent) error { return l.commit(ctx, p) })
+}
+
+// process prepares events concurrently and commits them in order until eventsSub is closed.
+// Once an event fails to be committed, the subscription is cancelled and events after it are
+// skipped, so they are received again by resubscribing after the last saved checkpoint.
+// It reports whether any event is received.
+func (l *listener) process(eventsSub <-chan *client.ChaincodeEvent, cancel context.CancelFunc, commit func(p *preparedEvent) error) (bool, error) {
+	jobs := make(chan job, l.config.QueueSize)
+	// results in order of events
+	pending := make(chan chan *preparedEvent, l.config.QueueSize)
+
+	var workers sync.WaitGroup
+	for i := 0; i < l.config.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				j.result <- l.prepare(j.event)
 			}
-			err = eventHandler(e)
-			if err != nil {
-				klog.Errorf("[Error] handle event %s erorr %s", e.EventName, err.Error())
-				continue
+		}()
+	}
+
+	var commitErr error
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		for result := range pending {
+			p := <-result
+			if commitErr == nil {
+				if err := commit(p); err != nil {
+					commitErr = errors.Wrapf(err, "commit event %s in transaction %s", p.event.EventName, p.event.TransactionID)
+					klog.Errorf("[Error] %s, resubscribe from the last checkpoint", commitErr)
+					cancel()
+				} else {
+					klog.V(5).Infof("[Debug] event %+v", *p.event)
+				}
 			}
+			atomic.AddInt64(&l.queued, -1)
+			queueDepth.Dec()
+		}
+	}()
+
+	received := false
+	for e := range eventsSub {
+		received = true
+		result := make(chan *preparedEvent, 1)
+		atomic.AddInt64(&l.queued, 1)
+		queueDepth.Inc()
+		// blocks when QueueSize events are waiting to be committed
+		pending <- result
+		jobs <- job{event: e, result: result}
+	}
+	close(jobs)
+	close(pending)
+	<-committed
+	workers.Wait()
+	return received, commitErr
+}
+
+// prepare runs the handler of event e, which does not touch database
+func (l *listener) prepare(e *client.ChaincodeEvent) *preparedEvent {
+	p := &preparedEvent{event: e}
+	// check whether event registered
+	eventHandler, ok := l.registeredEvents[events.Event(e.EventName)]
+	if !ok {
+		klog.Warningf("Event %s not registered, skip", e.EventName)
+		return p
+	}
+	start := time.Now()
+	p.commit, p.err = eventHandler(e)
+	prepareDuration.Observe(time.Since(start).Seconds())
+	return p
+}
 
-			klog.V(5).Infof("[Debug] event %+v", *e)
+// commit stores results of a prepared event and saves its checkpoint in one database transaction,
+// so each event is processed exactly once across restarts.
+// If the event failed, it is put into dead letters with its checkpoint instead. An error is returned
+// only if neither is stored, then the event is received again after resubscription instead of being lost.
+func (l *listener) commit(ctx context.Context, p *preparedEvent) error {
+	e := p.event
+	var checkpoint models.Checkpoint
+	handleErr := p.err
+	if handleErr == nil {
+		handleErr = l.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+			if p.commit != nil {
+				if err := p.commit(tx); err != nil {
+					return err
+				}
+			}
+			var err error
+			checkpoint, err = l.checkpointer.Save(tx, e)
+			return err
+		})
+		if handleErr == nil {
+			l.checkpointer.Commit(checkpoint)
+			eventsTotal.WithLabelValues("committed").Inc()
+			checkpointBlock.Set(float64(e.BlockNumber))
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return handleErr
+	}
 
-		case <-ctx.Done():
-			klog.Info("context break down")
-			return
+	klog.Errorf("[Error] handle event %s in transaction %s: %s, put into dead letters", e.EventName, e.TransactionID, handleErr)
+	err := l.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := l.deadLetters.Put(tx, e, handleErr); err != nil {
+			return err
 		}
+		var err error
+		checkpoint, err = l.checkpointer.Save(tx, e)
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "put dead letter for %s", handleErr)
 	}
+	l.checkpointer.Commit(checkpoint)
+	eventsTotal.WithLabelValues("deadlettered").Inc()
+	checkpointBlock.Set(float64(e.BlockNumber))
+	return nil
 }
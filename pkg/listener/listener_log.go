@@ -20,6 +20,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/bestchains/bc-saas/pkg/models"
 	"k8s.io/klog/v2"
 )
 
@@ -30,6 +31,10 @@ type logListner struct {
 func NewLogListener() Listener {
 	return &logListner{x: 0}
 }
+func (ll *logListner) State() models.ListenerState {
+	return models.ListenerState{Status: models.ListenerDisabled}
+}
+
 func (ll *logListner) Events(ctx context.Context) {
 	klog.Infoln("starting logListener")
 	for {
@@ -0,0 +1,228 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/events"
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+const testEvent = "PutValue"
+
+func newTestEvents(n int) []*client.ChaincodeEvent {
+	result := make([]*client.ChaincodeEvent, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, &client.ChaincodeEvent{BlockNumber: uint64(i), TransactionID: fmt.Sprintf("tx%d", i), EventName: testEvent})
+	}
+	return result
+}
+
+// stream sends es, then closes the returned channel once ctx is done like a live subscription
+func stream(ctx context.Context, es []*client.ChaincodeEvent) <-chan *client.ChaincodeEvent {
+	ch := make(chan *client.ChaincodeEvent)
+	go func() {
+		defer close(ch)
+		for _, e := range es {
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return ch
+}
+
+// TestListener_process tests events are prepared concurrently but committed in order,
+// and nothing is committed after a failed commit
+func TestListener_process(t *testing.T) {
+	es := newTestEvents(20)
+	l := &listener{
+		config: PipelineConfig{Concurrency: 4, QueueSize: 3},
+		registeredEvents: map[events.Event]events.EventHandler{
+			testEvent: func(e *client.ChaincodeEvent) (events.Commit, error) {
+				// later events are prepared faster
+				time.Sleep(time.Duration(len(es)-int(e.BlockNumber)) * time.Millisecond)
+				if e.BlockNumber == 5 {
+					return nil, errors.New("ledger unavailable")
+				}
+				return func(orm.DB) error { return nil }, nil
+			},
+		},
+	}
+
+	var mu sync.Mutex
+	committed := make([]string, 0)
+	deadLetters := make([]string, 0)
+	commit := func(failAt uint64) func(p *preparedEvent) error {
+		return func(p *preparedEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if p.event.BlockNumber == failAt {
+				return errors.New("database unavailable")
+			}
+			if p.err != nil {
+				deadLetters = append(deadLetters, p.event.TransactionID)
+			} else {
+				committed = append(committed, p.event.TransactionID)
+			}
+			return nil
+		}
+	}
+
+	// all events are committed in order, and the failed one is dead lettered
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	go func() {
+		// stream is closed by the test once all events are committed
+		for {
+			mu.Lock()
+			done := len(committed)+len(deadLetters) == len(es)
+			mu.Unlock()
+			if done {
+				cancel()
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	received, err := l.process(stream(ctx, es), cancel, commit(0))
+	assert.True(t, received)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tx5"}, deadLetters)
+	assert.Len(t, committed, len(es)-1)
+	for i, txID := range committed {
+		if i < 4 {
+			assert.Equal(t, fmt.Sprintf("tx%d", i+1), txID)
+		} else {
+			assert.Equal(t, fmt.Sprintf("tx%d", i+2), txID)
+		}
+	}
+	assert.Zero(t, l.queued)
+
+	// a failed commit, including a failed dead letter, cancels the subscription and skips events after it
+	for _, failAt := range []uint64{3, 5} {
+		committed, deadLetters = committed[:0], deadLetters[:0]
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		received, err = l.process(stream(ctx, es), cancel, commit(failAt))
+		require.Equal(t, context.Canceled, ctx.Err(), "subscription is cancelled before timeout")
+		assert.True(t, received)
+		assert.ErrorContains(t, err, fmt.Sprintf("transaction tx%d", failAt))
+		assert.Equal(t, []string{"tx1", "tx2", "tx3", "tx4"}[:failAt-1], committed)
+		assert.Empty(t, deadLetters)
+		assert.Zero(t, l.queued)
+		cancel()
+	}
+}
+
+// fakeStore fails to commit the event in block failAt once
+type fakeStore struct {
+	checkpoint models.Checkpoint
+	committed  []string
+	failAt     uint64
+}
+
+func (s *fakeStore) Checkpoint(channel, contract string) (models.Checkpoint, error) {
+	return s.checkpoint, nil
+}
+
+func (s *fakeStore) Commit(depositories []*models.Depository, checkpoint models.Checkpoint) error {
+	if checkpoint.BlockNumber == s.failAt {
+		s.failAt = 0
+		return errors.New("database unavailable")
+	}
+	s.checkpoint = checkpoint
+	s.committed = append(s.committed, checkpoint.TransactionID)
+	return nil
+}
+
+// TestStoreListener_consume tests events are subscribed after the last checkpoint, which is saved
+// with each event, and resubscribed after it once an event fails
+func TestStoreListener_consume(t *testing.T) {
+	es := newTestEvents(5)
+	store := &fakeStore{checkpoint: models.Checkpoint{Channel: "channel", Contract: "depository", BlockNumber: 2, TransactionID: "tx2"}, failAt: 4}
+	subscribed := make([]string, 0)
+	subscribe := func(ctx context.Context, checkpoint client.Checkpoint) (<-chan *client.ChaincodeEvent, error) {
+		subscribed = append(subscribed, checkpoint.TransactionID())
+		// events after checkpoint, then the stream is broken
+		ch := make(chan *client.ChaincodeEvent, len(es))
+		for _, e := range es {
+			if e.BlockNumber > checkpoint.BlockNumber() {
+				ch <- e
+			}
+		}
+		close(ch)
+		return ch, nil
+	}
+	l, err := NewStoreListener(store, "channel", "depository", subscribe, map[events.Event]Prepare{
+		testEvent: func(e *client.ChaincodeEvent) (*models.Depository, error) {
+			return &models.Depository{KID: e.TransactionID}, nil
+		},
+	})
+	require.NoError(t, err)
+	sl := l.(*storeListener)
+
+	received, err := sl.consume(context.Background())
+	assert.True(t, received)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"tx3"}, store.committed)
+	assert.Equal(t, uint64(3), l.State().BlockNumber)
+
+	received, err = sl.consume(context.Background())
+	assert.True(t, received)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tx2", "tx3"}, subscribed)
+	assert.Equal(t, []string{"tx3", "tx4", "tx5"}, store.committed)
+	assert.Equal(t, "tx5", l.State().TransactionID)
+}
+
+// TestRetryDelay tests retries of dead letters are delayed exponentially up to maxRetryDelay
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, minRetryDelay, retryDelay(1))
+	assert.Equal(t, 2*minRetryDelay, retryDelay(2))
+	assert.Equal(t, maxRetryDelay, retryDelay(maxAttempts))
+}
+
+// TestSubscription_setStatus tests only resubscriptions after a connection are counted as reconnects
+func TestSubscription_setStatus(t *testing.T) {
+	s := newSubscription()
+	// failures before the first connection
+	s.setStatus(models.ListenerConnecting, nil)
+	s.setStatus(models.ListenerDisconnected, errors.New("peer unavailable"))
+	s.setStatus(models.ListenerConnecting, nil)
+	assert.Equal(t, 0, s.State().Reconnects)
+
+	s.setStatus(models.ListenerConnected, nil)
+	s.setStatus(models.ListenerDisconnected, errors.New("stream closed"))
+	s.setStatus(models.ListenerConnecting, nil)
+	state := s.State()
+	assert.Equal(t, models.ListenerConnecting, state.Status)
+	assert.Equal(t, 1, state.Reconnects)
+	assert.Equal(t, "stream closed", state.LastError)
+}
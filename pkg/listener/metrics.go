@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "listener",
+		Name:      "queue_depth",
+		Help:      "Number of received events waiting to be committed",
+	})
+	eventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bc_saas",
+		Subsystem: "listener",
+		Name:      "events_total",
+		Help:      "Number of handled events by result(committed or deadlettered)",
+	}, []string{"result"})
+	prepareDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "bc_saas",
+		Subsystem: "listener",
+		Name:      "prepare_duration_seconds",
+		Help:      "Time to prepare an event",
+		Buckets:   prometheus.DefBuckets,
+	})
+	checkpointBlock = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "listener",
+		Name:      "checkpoint_block",
+		Help:      "Block number of the last committed event",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth, eventsTotal, prepareDuration, checkpointBlock)
+}
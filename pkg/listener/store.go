@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/events"
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+// Store persists depositories together with the checkpoint of the event which creates them
+type Store interface {
+	Checkpoint(channel, contract string) (models.Checkpoint, error)
+	Commit(depositories []*models.Depository, checkpoint models.Checkpoint) error
+}
+
+// Prepare returns the depository created by a chaincode event without storing it
+type Prepare func(e *client.ChaincodeEvent) (*models.Depository, error)
+
+// storeListener listens chaincode events and commits them into a Store one by one.
+// There are no dead letters. A failed event is retried by resubscribing after the last checkpoint.
+type storeListener struct {
+	// event registered and its handler
+	registeredEvents map[events.Event]Prepare
+
+	store        Store
+	checkpointer *Checkpointer
+	subscribe    Subscribe
+
+	// subscription lifecycle and state
+	subscription
+}
+
+func NewStoreListener(store Store, channel string, contract string, subscribe Subscribe, registeredEvents map[events.Event]Prepare) (Listener, error) {
+	if store == nil || subscribe == nil {
+		return nil, errors.New("invalid arguments")
+	}
+	checkpoint, err := store.Checkpoint(channel, contract)
+	if err != nil {
+		return nil, err
+	}
+	if registeredEvents == nil {
+		registeredEvents = make(map[events.Event]Prepare)
+	}
+	return &storeListener{
+		registeredEvents: registeredEvents,
+		store:            store,
+		checkpointer:     &Checkpointer{checkpoint: checkpoint},
+		subscribe:        subscribe,
+		subscription:     newSubscription(),
+	}, nil
+}
+
+// State returns the current state of subscription
+func (l *storeListener) State() models.ListenerState {
+	state := l.subscription.State()
+	state.BlockNumber = l.checkpointer.BlockNumber()
+	state.TransactionID = l.checkpointer.TransactionID()
+	return state
+}
+
+// Events subscribes chaincode events and handles them until ctx is done
+func (l *storeListener) Events(ctx context.Context) {
+	klog.Info("starting fetch events")
+	l.run(ctx, l.consume)
+}
+
+// consume subscribes once and handles events until the stream is closed or an event fails.
+// It reports whether any event is received.
+func (l *storeListener) consume(ctx context.Context) (bool, error) {
+	l.setStatus(models.ListenerConnecting, nil)
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	eventsSub, err := l.subscribe(subCtx, l.checkpointer)
+	if err != nil {
+		return false, errors.Wrap(err, "subscribe events")
+	}
+	l.setStatus(models.ListenerConnected, nil)
+	klog.Infof("subscribed events after transaction %q in block %d", l.checkpointer.TransactionID(), l.checkpointer.BlockNumber())
+
+	received := false
+	for e := range eventsSub {
+		received = true
+		if err := l.handle(e); err != nil {
+			return received, errors.Wrapf(err, "handle event %s in transaction %s", e.EventName, e.TransactionID)
+		}
+		klog.V(5).Infof("[Debug] event %+v", *e)
+	}
+	return received, nil
+}
+
+// handle prepares event e and commits its depository with its checkpoint
+func (l *storeListener) handle(e *client.ChaincodeEvent) error {
+	depositories := make([]*models.Depository, 0, 1)
+	if prepare, ok := l.registeredEvents[events.Event(e.EventName)]; ok {
+		start := time.Now()
+		d, err := prepare(e)
+		prepareDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			return err
+		}
+		depositories = append(depositories, d)
+	} else {
+		klog.Warningf("Event %s not registered, skip", e.EventName)
+	}
+
+	l.checkpointer.mu.RLock()
+	checkpoint := l.checkpointer.checkpoint
+	l.checkpointer.mu.RUnlock()
+	checkpoint.BlockNumber = e.BlockNumber
+	checkpoint.TransactionID = e.TransactionID
+	checkpoint.UpdatedAt = time.Now().Unix()
+	if err := l.store.Commit(depositories, checkpoint); err != nil {
+		return err
+	}
+	l.checkpointer.Commit(checkpoint)
+	eventsTotal.WithLabelValues("committed").Inc()
+	checkpointBlock.Set(float64(e.BlockNumber))
+	return nil
+}
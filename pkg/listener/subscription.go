@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// subscription manages lifecycle and state of an event subscription
+type subscription struct {
+	mu    sync.RWMutex
+	state models.ListenerState
+	// established is true once connected, so the first connection is not counted as a reconnect
+	established bool
+}
+
+func newSubscription() subscription {
+	return subscription{
+		state: models.ListenerState{
+			Status: models.ListenerDisconnected,
+			Since:  time.Now().Unix(),
+		},
+	}
+}
+
+// State returns connection state of subscription
+func (s *subscription) State() models.ListenerState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+func (s *subscription) setStatus(status models.ListenerStatus, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == models.ListenerConnecting && s.state.Status == models.ListenerDisconnected && s.established {
+		s.state.Reconnects++
+	}
+	if status == models.ListenerConnected {
+		s.established = true
+	}
+	s.state.Status = status
+	s.state.Since = time.Now().Unix()
+	if err != nil {
+		s.state.LastError = err.Error()
+	}
+}
+
+// run calls consume until ctx is done. consume subscribes once and handles events until the
+// stream is closed, and reports whether any event is received. Once the stream is broken,
+// it is resubscribed with exponential backoff.
+func (s *subscription) run(ctx context.Context, consume func(ctx context.Context) (bool, error)) {
+	backoff := minBackoff
+	for {
+		received, err := consume(ctx)
+		if ctx.Err() != nil {
+			s.setStatus(models.ListenerStopped, nil)
+			klog.Info("context break down")
+			return
+		}
+		if received {
+			backoff = minBackoff
+		}
+		if err == nil {
+			err = errors.New("event stream closed")
+		}
+		s.setStatus(models.ListenerDisconnected, err)
+		klog.Errorf("[Error] event subscription broken: %s, resubscribe in %s", err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			s.setStatus(models.ListenerStopped, nil)
+			klog.Info("context break down")
+			return
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
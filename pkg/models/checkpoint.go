@@ -0,0 +1,27 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// Checkpoint is the position of the last processed chaincode event of a contract
+type Checkpoint struct {
+	Channel  string `json:"channel" pg:"channel,pk"`
+	Contract string `json:"contract" pg:"contract,pk"`
+
+	BlockNumber   uint64 `json:"blockNumber" pg:"blockNumber,use_zero"`
+	TransactionID string `json:"transactionID" pg:"transactionID"`
+	UpdatedAt     int64  `json:"updatedAt" pg:"updatedAt"`
+}
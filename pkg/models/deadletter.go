@@ -0,0 +1,57 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "errors"
+
+// DeadLetterStatus is the status of a dead-lettered event
+type DeadLetterStatus string
+
+const (
+	// DeadLetterPending will be retried automatically
+	DeadLetterPending DeadLetterStatus = "pending"
+	// DeadLetterFailed ran out of automatic retries, but can still be replayed
+	DeadLetterFailed DeadLetterStatus = "failed"
+	// DeadLetterResolved is handled successfully by a retry or replay
+	DeadLetterResolved DeadLetterStatus = "resolved"
+	// DeadLetterDiscarded will never be handled
+	DeadLetterDiscarded DeadLetterStatus = "discarded"
+)
+
+// ErrDeadLetterNotReplayable is returned when replaying or discarding a resolved or discarded dead letter
+var ErrDeadLetterNotReplayable = errors.New("dead letter is resolved or discarded")
+
+// DeadLetter is a chaincode event which failed to be handled
+type DeadLetter struct {
+	ID       int64  `json:"id" pg:"id,pk"`
+	Contract string `json:"contract" pg:"contract"`
+
+	EventName     string `json:"eventName" pg:"eventName"`
+	BlockNumber   uint64 `json:"blockNumber" pg:"blockNumber,use_zero"`
+	TransactionID string `json:"transactionID" pg:"transactionID,unique"`
+	Payload       []byte `json:"payload" pg:"payload"`
+
+	Status DeadLetterStatus `json:"status" pg:"status"`
+	// Error of the last attempt
+	Error    string `json:"error" pg:"error"`
+	Attempts int    `json:"attempts" pg:"attempts,use_zero"`
+	// NextRetryAt is when a pending event will be retried
+	NextRetryAt int64 `json:"nextRetryAt" pg:"nextRetryAt,use_zero"`
+
+	CreatedAt int64 `json:"createdAt" pg:"createdAt"`
+	UpdatedAt int64 `json:"updatedAt" pg:"updatedAt"`
+}
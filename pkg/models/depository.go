@@ -41,6 +41,24 @@ type Depository struct {
 	TrustedTimestamp int64  `json:"trustedTimestamp" pg:"trustedTimestamp"`
 	ContentSize      int64  `json:"contentSize" pg:"contentSize"`
 	Description      string `json:"description" pg:"description"`
+
+	// IngestedAt is the time when this depository was indexed by bc-saas.
+	// TrustedTimestamp always comes from ledger.
+	IngestedAt int64 `json:"ingestedAt" pg:"ingestedAt"`
+
+	// TimestampToken is a RFC 3161 timestamp token(DER) for ContentID from a timestamp authority
+	TimestampToken []byte `json:"timestampToken,omitempty" pg:"timestampToken"`
+	// TimestampTokenTime is the time attested by TimestampToken
+	TimestampTokenTime int64 `json:"timestampTokenTime,omitempty" pg:"timestampTokenTime"`
+	// TimestampTokenVerified is set when TimestampToken is verified on retrieval
+	TimestampTokenVerified *bool `json:"timestampTokenVerified,omitempty" pg:"-"`
+
+	// SearchVector indexes name, contentName and description for full-text search. See SearchVector
+	SearchVector string `json:"-" pg:"searchVector,type:tsvector"`
+	// Highlights are matched fields with terms emphasized in a full-text search
+	Highlights map[string]string `json:"highlights,omitempty" pg:"-"`
+	// Moderation is set on retrieval if the depository is moderated
+	Moderation ModerationStatus `json:"moderation,omitempty" pg:"-"`
 }
 
 var _ pg.QueryHook = (*Depository)(nil)
@@ -0,0 +1,58 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// ListenerStatus is the status of the chaincode event subscription
+type ListenerStatus string
+
+const (
+	ListenerDisabled     ListenerStatus = "disabled"
+	ListenerConnecting   ListenerStatus = "connecting"
+	ListenerConnected    ListenerStatus = "connected"
+	ListenerDisconnected ListenerStatus = "disconnected"
+	ListenerStopped      ListenerStatus = "stopped"
+)
+
+// ListenerState is the state of event listener. It is not persisted.
+type ListenerState struct {
+	Status ListenerStatus `json:"status"`
+	// Since is the time when Status changed
+	Since int64 `json:"since"`
+	// Reconnects is the number of resubscriptions after the first established connection
+	Reconnects int `json:"reconnects"`
+	// LastError which caused disconnection
+	LastError string `json:"lastError,omitempty"`
+
+	// QueueDepth is the number of received events waiting to be committed
+	QueueDepth int64 `json:"queueDepth"`
+
+	// Checkpoint of the last processed event
+	BlockNumber   uint64 `json:"blockNumber"`
+	TransactionID string `json:"transactionID"`
+}
+
+// LeaderState is the state of leader election among replicas. Only the leader ingests events.
+type LeaderState struct {
+	// Identity of this replica
+	Identity string `json:"identity"`
+	Leader   bool   `json:"leader"`
+	// Since is the time when Leader changed
+	Since int64 `json:"since"`
+	// Transitions is the number of times this replica became leader or lost leadership
+	Transitions int    `json:"transitions"`
+	LastError   string `json:"lastError,omitempty"`
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// SchemaMigration is an applied migration
+type SchemaMigration struct {
+	Version   int    `json:"version" pg:"version,pk"`
+	Name      string `json:"name" pg:"name"`
+	AppliedAt int64  `json:"appliedAt" pg:"appliedAt"`
+}
+
+// Migration upgrades the schema to Version
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(db orm.DB) error
+}
+
+// migrations in order of versions. Tables are created from the latest models by the first
+// migration, so later ones must be idempotent, such as ADD COLUMN IF NOT EXISTS.
+var migrations = []Migration{
+	{Version: 1, Name: "create tables", Up: func(db orm.DB) error {
+		return createTables(db, models...)
+	}},
+	{Version: 2, Name: "add ingestion time and timestamp tokens of depositories", Up: addColumns(
+		column{(*Depository)(nil), "ingestedAt", "bigint"},
+		column{(*Depository)(nil), "timestampToken", "bytea"},
+		column{(*Depository)(nil), "timestampTokenTime", "bigint"},
+	)},
+	{Version: 3, Name: "add indexes for depository filters", Up: addIndexes(
+		index{(*Depository)(nil), "trusted_timestamp", `"trustedTimestamp"`},
+		index{(*Depository)(nil), "content_id", `"contentID"`},
+		index{(*Depository)(nil), "owner", `"owner"`},
+		index{(*Depository)(nil), "name", `"name"`},
+		index{(*Depository)(nil), "block_number", `"blockNumber", "transactionID"`},
+		index{(*DeadLetter)(nil), "status", `"status", "nextRetryAt"`},
+		index{(*Transaction)(nil), "transaction_id", `"transactionID"`},
+		index{(*WebhookDelivery)(nil), "status", `"status", "nextAttemptAt"`},
+		index{(*WebhookDelivery)(nil), "subscription", `"subscriptionID"`},
+		index{(*WebhookAttempt)(nil), "delivery", `"deliveryID"`},
+	)},
+	{Version: 4, Name: "add full-text search of depositories", Up: addSearchVector},
+	{Version: 5, Name: "add indexes for more depository filters", Up: addIndexes(
+		index{(*Depository)(nil), "transaction_id", `"transactionID"`},
+		index{(*Depository)(nil), "operator", `"operator"`},
+		index{(*Depository)(nil), "platform", `"platform"`},
+		index{(*Depository)(nil), "content_type", `"contentType"`},
+		index{(*Depository)(nil), "content_size", `"contentSize"`},
+	)},
+	{Version: 6, Name: "add moderation of depositories", Up: func(db orm.DB) error {
+		if err := createTables(db, (*Moderation)(nil), (*ModerationFlag)(nil)); err != nil {
+			return err
+		}
+		return addIndexes(
+			index{(*Moderation)(nil), "status", `"status"`},
+			index{(*ModerationFlag)(nil), "kid", `"kid", "id"`},
+		)(db)
+	}},
+	{Version: 7, Name: "add account bindings of users", Up: func(db orm.DB) error {
+		if err := createTables(db, (*AccountBinding)(nil)); err != nil {
+			return err
+		}
+		return addIndexes(index{(*AccountBinding)(nil), "user", `"user"`})(db)
+	}},
+}
+
+// Migrate applies pending migrations and returns their versions. Replicas which migrate at
+// the same time are serialized by an advisory lock.
+func Migrate(db *pg.DB) ([]int, error) {
+	applied := make([]int, 0)
+	for {
+		migration, err := migrateNext(db)
+		if err != nil {
+			return applied, err
+		}
+		if migration == nil {
+			return applied, nil
+		}
+		applied = append(applied, migration.Version)
+	}
+}
+
+// migrateNext applies the first pending migration in a transaction
+func migrateNext(db *pg.DB) (*Migration, error) {
+	var next *Migration
+	err := db.RunInTransaction(context.TODO(), func(tx *pg.Tx) error {
+		// released when tx ends
+		// keyed by schema so networks sharing a database migrate independently
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext(current_schema() || '.' || ?))`, TableName((*SchemaMigration)(nil))); err != nil {
+			return errors.Wrap(err, "lock schema migrations")
+		}
+		err := tx.Model((*SchemaMigration)(nil)).CreateTable(&orm.CreateTableOptions{IfNotExists: true})
+		if err != nil {
+			return errors.Wrap(err, "create schema migration table")
+		}
+		version, err := SchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		for i := range migrations {
+			if migrations[i].Version > version {
+				next = &migrations[i]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+
+		klog.Infof("Migrating schema to version %d: %s", next.Version, next.Name)
+		if err = next.Up(tx); err != nil {
+			return errors.Wrapf(err, "migrate schema to version %d", next.Version)
+		}
+		_, err = tx.Model(&SchemaMigration{Version: next.Version, Name: next.Name, AppliedAt: time.Now().Unix()}).Insert()
+		return errors.Wrap(err, "record schema migration")
+	})
+	return next, err
+}
+
+// SchemaVersion returns the version of the latest applied migration
+func SchemaVersion(db orm.DB) (int, error) {
+	var version int
+	err := db.Model((*SchemaMigration)(nil)).ColumnExpr("coalesce(max(version), 0)").Select(pg.Scan(&version))
+	if err != nil {
+		return 0, errors.Wrap(err, "get schema version")
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion is the version this build migrates to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func createTables(db orm.DB, models ...interface{}) error {
+	for _, model := range models {
+		err := db.Model(model).CreateTable(&orm.CreateTableOptions{
+			IfNotExists: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type column struct {
+	model interface{}
+	name  string
+	typ   string
+}
+
+func addColumns(columns ...column) func(db orm.DB) error {
+	return func(db orm.DB) error {
+		for _, c := range columns {
+			_, err := db.Model(c.model).Exec(fmt.Sprintf(`ALTER TABLE ?TableName ADD COLUMN IF NOT EXISTS %q %s`, c.name, c.typ))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type index struct {
+	model interface{}
+	// name is suffixed to the table name
+	name    string
+	columns string
+}
+
+func addIndexes(indexes ...index) func(db orm.DB) error {
+	return func(db orm.DB) error {
+		for _, i := range indexes {
+			name := fmt.Sprintf("%s_%s_idx", TableName(i.model), i.name)
+			_, err := db.Model(i.model).Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS ? ON ?TableName (%s)`, i.columns), pg.Ident(name))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addSearchVector adds and fills search vectors of depositories with a GIN index
+func addSearchVector(db orm.DB) error {
+	if err := addColumns(column{(*Depository)(nil), "searchVector", "tsvector"})(db); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_search_vector_idx", TableName((*Depository)(nil)))
+	if _, err := db.Model((*Depository)(nil)).Exec(`CREATE INDEX IF NOT EXISTS ? ON ?TableName USING gin ("searchVector")`, pg.Ident(name)); err != nil {
+		return err
+	}
+	// segmented by SearchVector, which is not available in sql
+	const batch = 1000
+	last := ""
+	for {
+		var depositories []Depository
+		err := db.Model(&depositories).Column("kid", "name", "contentName", "description").
+			Where("kid > ?", last).Order("kid").Limit(batch).Select()
+		if err != nil {
+			return err
+		}
+		for i := range depositories {
+			d := &depositories[i]
+			if _, err := db.Model(d).Set(`"searchVector" = ?::tsvector`, SearchVector(d)).WherePK().Update(); err != nil {
+				return err
+			}
+		}
+		if len(depositories) < batch {
+			return nil
+		}
+		last = depositories[len(depositories)-1].KID
+	}
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMigrations tests versions of migrations are unique and in order
+func TestMigrations(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, m.Name)
+		assert.NotEmpty(t, m.Name)
+		assert.NotNil(t, m.Up, m.Name)
+	}
+	assert.Equal(t, len(migrations), LatestSchemaVersion())
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package models
 
 import (
+	"reflect"
+	"strings"
+
 	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 )
@@ -24,17 +27,30 @@ import (
 var (
 	models = []interface{}{
 		(*Depository)(nil),
+		(*Checkpoint)(nil),
+		(*DeadLetter)(nil),
+		(*Transaction)(nil),
+		(*WebhookSubscription)(nil),
+		(*WebhookDelivery)(nil),
+		(*WebhookAttempt)(nil),
+		(*ReindexJob)(nil),
+		(*Moderation)(nil),
+		(*ModerationFlag)(nil),
+		(*AccountBinding)(nil),
 	}
 )
 
+// Init migrates the database to the latest schema
 func Init(pgdb *pg.DB) error {
-	for _, model := range models {
-		err := pgdb.Model(model).CreateTable(&orm.CreateTableOptions{
-			IfNotExists: true,
-		})
-		if err != nil {
-			return err
-		}
+	_, err := Migrate(pgdb)
+	return err
+}
+
+// TableName returns the unquoted table name of model
+func TableName(model interface{}) string {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
 	}
-	return nil
+	return strings.Trim(string(orm.GetTable(typ).SQLName), `"`)
 }
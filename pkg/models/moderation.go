@@ -0,0 +1,49 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// ModerationStatus of a depository, which only affects how it is served off-chain
+type ModerationStatus string
+
+const (
+	// ModerationHidden depositories are only served to admins
+	ModerationHidden ModerationStatus = "hidden"
+	// ModerationDisputed depositories are served with their status, but have no certificates
+	ModerationDisputed ModerationStatus = "disputed"
+	// ModerationRestored depositories are served as usual
+	ModerationRestored ModerationStatus = "restored"
+)
+
+// Moderation is the current moderation status of a depository. Restored depositories have none.
+// It is kept apart from depositories so that it survives reindex.
+type Moderation struct {
+	KID       string           `json:"kid" pg:"kid,pk"`
+	Status    ModerationStatus `json:"status" pg:"status"`
+	Reason    string           `json:"reason" pg:"reason"`
+	Operator  string           `json:"operator" pg:"operator"`
+	UpdatedAt int64            `json:"updatedAt" pg:"updatedAt"`
+}
+
+// ModerationFlag audits a change of moderation status
+type ModerationFlag struct {
+	ID        int64            `json:"id" pg:"id,pk"`
+	KID       string           `json:"kid" pg:"kid"`
+	Status    ModerationStatus `json:"status" pg:"status"`
+	Reason    string           `json:"reason" pg:"reason"`
+	Operator  string           `json:"operator" pg:"operator"`
+	CreatedAt int64            `json:"createdAt" pg:"createdAt"`
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// ReconcileReport is the drift between the depository index and ledger found by a reconciliation
+type ReconcileReport struct {
+	StartedAt  int64 `json:"startedAt"`
+	FinishedAt int64 `json:"finishedAt"`
+
+	// LedgerTotal is the number of depositories on ledger
+	LedgerTotal uint64 `json:"ledgerTotal"`
+	// Indexed is the number of indexed depositories
+	Indexed int64 `json:"indexed"`
+
+	// MissingIndexes on ledger but not indexed. At most 1000 are listed
+	MissingIndexes      []uint64 `json:"missingIndexes"`
+	MissingIndexesTotal int64    `json:"missingIndexesTotal"`
+	// MissingTransactions are valid depository transactions found by the block listener but not indexed
+	MissingTransactions []string `json:"missingTransactions"`
+
+	// Sampled rows compared with ledger state
+	Sampled    int                 `json:"sampled"`
+	Mismatches []ReconcileMismatch `json:"mismatches"`
+
+	// Repaired depositories, if repair is enabled
+	Repaired int      `json:"repaired"`
+	Errors   []string `json:"errors"`
+}
+
+// ReconcileMismatch is an indexed depository whose fields differ from ledger state
+type ReconcileMismatch struct {
+	KID    string   `json:"kid"`
+	Fields []string `json:"fields"`
+}
+
+// Drifted returns true if the index doesn't match ledger
+func (r *ReconcileReport) Drifted() bool {
+	return r.LedgerTotal != uint64(r.Indexed) || r.MissingIndexesTotal > 0 || len(r.MissingTransactions) > 0 || len(r.Mismatches) > 0
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "errors"
+
+// ReindexStatus is the status of a reindex job
+type ReindexStatus string
+
+const (
+	// ReindexRunning is replaying blocks, or was interrupted while doing so
+	ReindexRunning ReindexStatus = "running"
+	// ReindexFailed stopped with an error. It can be resumed
+	ReindexFailed ReindexStatus = "failed"
+	// ReindexCompleted has swapped its table in as the depository index
+	ReindexCompleted ReindexStatus = "completed"
+	// ReindexCancelled dropped its table
+	ReindexCancelled ReindexStatus = "cancelled"
+)
+
+var (
+	// ErrReindexRunning is returned when starting a reindex job while another one is running
+	ErrReindexRunning = errors.New("a reindex job is running")
+	// ErrReindexFinished is returned when cancelling a completed or cancelled reindex job
+	ErrReindexFinished = errors.New("reindex job is completed or cancelled")
+)
+
+// ReindexJob rebuilds the depository index from ledger into a fresh table
+type ReindexJob struct {
+	ID     int64         `json:"id" pg:"id,pk"`
+	Status ReindexStatus `json:"status" pg:"status"`
+	// Table which depositories are indexed into before swapped in
+	Table string `json:"table" pg:"table"`
+
+	// FromBlock is the first replayed block. Depositories before it are copied from the current index
+	FromBlock uint64 `json:"fromBlock" pg:"fromBlock,use_zero"`
+	// NextBlock to replay, which is where an interrupted job resumes
+	NextBlock uint64 `json:"nextBlock" pg:"nextBlock,use_zero"`
+	// TargetBlock is the ledger height to replay to
+	TargetBlock uint64 `json:"targetBlock" pg:"targetBlock,use_zero"`
+	// Indexed depositories so far
+	Indexed int64 `json:"indexed" pg:"indexed,use_zero"`
+	// Total depositories on ledger when the job started
+	Total uint64 `json:"total" pg:"total,use_zero"`
+	Error string `json:"error" pg:"error"`
+
+	CreatedAt  int64 `json:"createdAt" pg:"createdAt"`
+	UpdatedAt  int64 `json:"updatedAt" pg:"updatedAt"`
+	FinishedAt int64 `json:"finishedAt" pg:"finishedAt"`
+}
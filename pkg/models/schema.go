@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// maxIdentifierLength is the max length of postgreSQL identifiers
+const maxIdentifierLength = 63
+
+var invalidSchemaChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// SchemaName returns the postgreSQL schema of channel in network.
+// Names too long for postgreSQL are shortened with a hash.
+func SchemaName(network, channel string) string {
+	name := invalidSchemaChars.ReplaceAllString(strings.ToLower(network+"_"+channel), "_")
+	if len(name) <= maxIdentifierLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(network + "_" + channel))
+	return name[:maxIdentifierLength-17] + "_" + hex.EncodeToString(sum[:8])
+}
+
+// Connect returns a database handle of which all tables are in schema, so networks sharing
+// a database or a process are isolated without prefixing table names.
+func Connect(opts *pg.Options, schema string) *pg.DB {
+	onConnect := opts.OnConnect
+	opts.OnConnect = func(ctx context.Context, cn *pg.Conn) error {
+		// public is kept for extensions
+		if _, err := cn.ExecContext(ctx, `SET search_path TO ?, public`, pg.Ident(schema)); err != nil {
+			return errors.Wrap(err, "set search path")
+		}
+		if onConnect != nil {
+			return onConnect(ctx, cn)
+		}
+		return nil
+	}
+	return pg.Connect(opts)
+}
+
+// CreateSchema creates schema and moves tables of older versions into it, which were in another schema with
+// names prefixed by legacyPrefix, such as "{network}_{channel}_depository". Moved tables are returned.
+func CreateSchema(db *pg.DB, schema string, legacyPrefix string) ([]string, error) {
+	moved := make([]string, 0)
+	err := db.RunInTransaction(context.TODO(), func(tx *pg.Tx) error {
+		// replicas starting together wait for each other
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext(?))`, schema); err != nil {
+			return errors.Wrap(err, "lock schema")
+		}
+		if _, err := tx.Exec(`CREATE SCHEMA IF NOT EXISTS ?`, pg.Ident(schema)); err != nil {
+			return errors.Wrap(err, "create schema")
+		}
+		for _, model := range append([]interface{}{(*SchemaMigration)(nil)}, models...) {
+			legacy, err := moveLegacyTable(tx, model, schema, legacyPrefix)
+			if err != nil {
+				return err
+			}
+			if legacy != "" {
+				moved = append(moved, legacy)
+			}
+		}
+		return nil
+	})
+	return moved, err
+}
+
+// moveLegacyTable moves the legacy table of model into schema and renames it and its indexes
+func moveLegacyTable(tx *pg.Tx, model interface{}, schema string, legacyPrefix string) (string, error) {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	name := TableName(model)
+	var exists bool
+	if _, err := tx.QueryOne(pg.Scan(&exists), `SELECT to_regclass(format('%I.%I', ?, ?)) IS NOT NULL`, schema, name); err != nil {
+		return "", errors.Wrapf(err, "check table %s", name)
+	}
+	// tables were named by a global inflector, which didn't pluralize
+	for _, legacy := range []string{legacyPrefix + "_" + orm.GetTable(typ).ModelName, legacyPrefix + "_" + name} {
+		var legacySchema string
+		_, err := tx.QueryOne(pg.Scan(&legacySchema), `SELECT table_schema FROM information_schema.tables WHERE table_name = ? AND table_schema <> ? LIMIT 1`, legacy, schema)
+		if err == pg.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "find legacy table %s", legacy)
+		}
+		if exists {
+			klog.Warningf("Both legacy table %s.%s and table %s.%s exist, keep the legacy one as is", legacySchema, legacy, schema, name)
+			return "", nil
+		}
+
+		klog.Infof("Moving legacy table %s.%s to %s.%s", legacySchema, legacy, schema, name)
+		// indexes and sequences of the table are moved together
+		if _, err := tx.Exec(`ALTER TABLE ?.? SET SCHEMA ?`, pg.Ident(legacySchema), pg.Ident(legacy), pg.Ident(schema)); err != nil {
+			return "", errors.Wrapf(err, "move legacy table %s", legacy)
+		}
+		if _, err := tx.Exec(`ALTER TABLE ?.? RENAME TO ?`, pg.Ident(schema), pg.Ident(legacy), pg.Ident(name)); err != nil {
+			return "", errors.Wrapf(err, "rename legacy table %s", legacy)
+		}
+		var indexes []string
+		if _, err := tx.Query(pg.Scan(&indexes), `SELECT indexname FROM pg_indexes WHERE schemaname = ? AND tablename = ?`, schema, name); err != nil {
+			return "", errors.Wrapf(err, "list indexes of %s", name)
+		}
+		for _, index := range indexes {
+			if !strings.HasPrefix(index, legacy+"_") {
+				continue
+			}
+			renamed := name + strings.TrimPrefix(index, legacy)
+			if _, err := tx.Exec(`ALTER INDEX ?.? RENAME TO ?`, pg.Ident(schema), pg.Ident(index), pg.Ident(renamed)); err != nil {
+				return "", errors.Wrapf(err, "rename index %s", index)
+			}
+		}
+		return legacy, nil
+	}
+	return "", nil
+}
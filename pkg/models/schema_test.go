@@ -0,0 +1,35 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSchemaName tests sanitizing and shortening schema names
+func TestSchemaName(t *testing.T) {
+	assert.Equal(t, "proof_c0zpw_depository", SchemaName("proof-c0zpw", "depository"))
+	assert.Equal(t, "net_1_channel_a", SchemaName("Net.1", "Channel A"))
+
+	long := SchemaName(strings.Repeat("n", 60), "channel")
+	assert.Len(t, long, maxIdentifierLength)
+	assert.NotEqual(t, long, SchemaName(strings.Repeat("n", 60), "channel2"))
+	assert.Equal(t, long, SchemaName(strings.Repeat("n", 60), "channel"))
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Full-text search uses the simple configuration of postgreSQL, which has no Chinese parser.
+// Text is segmented here instead: latin words and numbers are lowercased terms, and runs of
+// CJK characters are split into overlapping bigrams, so "数字存证" is indexed as "数字", "字存", "存证".
+
+const (
+	// postgreSQL limits of tsvector
+	maxLexemeBytes = 2046
+	maxPosition    = 16383
+)
+
+// searchTerm is a word or a run of CJK characters in text
+type searchTerm struct {
+	runes []rune
+	cjk   bool
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// searchTerms splits text into lowercased terms
+func searchTerms(text string) []searchTerm {
+	terms := make([]searchTerm, 0)
+	var current *searchTerm
+	for _, r := range text {
+		var cjk bool
+		switch {
+		case isCJK(r):
+			cjk = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		default:
+			current = nil
+			continue
+		}
+		if current == nil || current.cjk != cjk {
+			terms = append(terms, searchTerm{cjk: cjk})
+			current = &terms[len(terms)-1]
+		}
+		current.runes = append(current.runes, unicode.ToLower(r))
+	}
+	return terms
+}
+
+// lexemes of a term. The last character of a CJK run is also a lexeme, so every character
+// starts a lexeme and a single character query matches by prefix.
+func (t searchTerm) lexemes() []string {
+	if !t.cjk {
+		return []string{string(t.runes)}
+	}
+	lexemes := make([]string, 0, len(t.runes))
+	for i := 0; i+1 < len(t.runes); i++ {
+		lexemes = append(lexemes, string(t.runes[i:i+2]))
+	}
+	return append(lexemes, string(t.runes[len(t.runes)-1:]))
+}
+
+// SearchWords returns lowercased words and CJK runs of a search query
+func SearchWords(q string) []string {
+	words := make([]string, 0)
+	for _, t := range searchTerms(q) {
+		words = append(words, string(t.runes))
+	}
+	return words
+}
+
+// SearchVector returns the tsvector literal of depository d. Lexemes of name, contentName and
+// description are weighted A, B and C, so matches in name rank first.
+func SearchVector(d *Depository) string {
+	positions := make(map[string][]string)
+	position := 0
+	for _, field := range []struct {
+		text   string
+		weight string
+	}{{d.Name, "A"}, {d.ContentName, "B"}, {d.Description, "C"}} {
+		for _, t := range searchTerms(field.text) {
+			for _, lexeme := range t.lexemes() {
+				if position >= maxPosition {
+					break
+				}
+				if len(lexeme) > maxLexemeBytes {
+					continue
+				}
+				position++
+				positions[lexeme] = append(positions[lexeme], fmt.Sprintf("%d%s", position, field.weight))
+			}
+		}
+	}
+	lexemes := make([]string, 0, len(positions))
+	for lexeme := range positions {
+		lexemes = append(lexemes, lexeme)
+	}
+	sort.Strings(lexemes)
+	var b strings.Builder
+	for i, lexeme := range lexemes {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(quoteLexeme(lexeme))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(positions[lexeme], ","))
+	}
+	return b.String()
+}
+
+// SearchQuery returns the tsquery literal matching all terms of q, or "" if q has no terms.
+// Latin words and single CJK characters match by prefix, and bigrams of a CJK run must be adjacent.
+func SearchQuery(q string) string {
+	parts := make([]string, 0)
+	for _, t := range searchTerms(q) {
+		if !t.cjk || len(t.runes) == 1 {
+			lexeme := string(t.runes)
+			if len(lexeme) <= maxLexemeBytes {
+				parts = append(parts, quoteLexeme(lexeme)+":*")
+			}
+			continue
+		}
+		bigrams := t.lexemes()
+		// the trailing single character is implied by the last bigram
+		bigrams = bigrams[:len(bigrams)-1]
+		for i := range bigrams {
+			bigrams[i] = quoteLexeme(bigrams[i])
+		}
+		parts = append(parts, "("+strings.Join(bigrams, " <-> ")+")")
+	}
+	return strings.Join(parts, " & ")
+}
+
+func quoteLexeme(lexeme string) string {
+	lexeme = strings.ReplaceAll(lexeme, `\`, `\\`)
+	return "'" + strings.ReplaceAll(lexeme, "'", "''") + "'"
+}
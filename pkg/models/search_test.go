@@ -0,0 +1,39 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSearchVector tests segmenting depositories into weighted lexemes
+func TestSearchVector(t *testing.T) {
+	d := &Depository{Name: "数字存证", ContentName: "Report-2023.PDF", Description: "It's a report"}
+	assert.Equal(t, `'2023':6B 'a':10C 'it':8C 'pdf':7B 'report':5B,11C 's':9C '字存':2A '存证':3A '数字':1A '证':4A`, SearchVector(d))
+	assert.Equal(t, "", SearchVector(&Depository{}))
+}
+
+// TestSearchQuery tests building tsquery from user input
+func TestSearchQuery(t *testing.T) {
+	assert.Equal(t, `('数字' <-> '字存' <-> '存证') & 'report':*`, SearchQuery("数字存证 Report"))
+	assert.Equal(t, `'证':*`, SearchQuery("证"))
+	assert.Equal(t, `'o':* & 'brien':*`, SearchQuery("O'Brien"))
+	assert.Equal(t, "", SearchQuery(" '&|! "))
+	assert.Equal(t, []string{"数字存证", "report"}, SearchWords("数字存证, Report"))
+}
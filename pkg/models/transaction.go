@@ -0,0 +1,35 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// Transaction is a transaction of the contract on ledger, either valid or not.
+// It is keyed by its position, as a transaction id is repeated by DUPLICATE_TXID transactions.
+type Transaction struct {
+	TransactionID string `json:"transactionID" pg:"transactionID"`
+	BlockNumber   uint64 `json:"blockNumber" pg:"blockNumber,pk,use_zero"`
+	// TxIndex is the position of transaction in block
+	TxIndex int `json:"txIndex" pg:"txIndex,pk,use_zero"`
+
+	// CreatorMSP is the MSP ID of the client who submitted this transaction
+	CreatorMSP string `json:"creatorMSP" pg:"creatorMSP"`
+	Function   string `json:"function" pg:"function"`
+	// ValidationCode is the name of peer.TxValidationCode, such as VALID or MVCC_READ_CONFLICT
+	ValidationCode string `json:"validationCode" pg:"validationCode"`
+	Valid          bool   `json:"valid" pg:"valid,use_zero"`
+	// Timestamp(unix seconds) of transaction on ledger
+	Timestamp int64 `json:"timestamp" pg:"timestamp"`
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// WebhookSubscription subscribes events of depositories to an URL
+type WebhookSubscription struct {
+	ID  int64  `json:"id" pg:"id,pk"`
+	URL string `json:"url" pg:"url"`
+	// Secret to sign payloads with HMAC-SHA256. It is only returned on creation.
+	Secret string `json:"secret,omitempty" pg:"secret"`
+	// EventTypes to deliver. All events are delivered if empty
+	EventTypes []string `json:"eventTypes" pg:"eventTypes,array"`
+	// Owner only delivers depositories of this owner if not empty
+	Owner  string `json:"owner" pg:"owner"`
+	Active bool   `json:"active" pg:"active,use_zero"`
+
+	CreatedAt int64 `json:"createdAt" pg:"createdAt"`
+	UpdatedAt int64 `json:"updatedAt" pg:"updatedAt"`
+}
+
+// WebhookDeliveryStatus is the status of a webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event to be delivered to a subscription
+type WebhookDelivery struct {
+	ID             int64  `json:"id" pg:"id,pk"`
+	SubscriptionID int64  `json:"subscriptionID" pg:"subscriptionID"`
+	EventType      string `json:"eventType" pg:"eventType"`
+	KID            string `json:"kid" pg:"kid"`
+	// Payload is the json body to post
+	Payload []byte `json:"payload" pg:"payload"`
+
+	Status        WebhookDeliveryStatus `json:"status" pg:"status"`
+	Attempts      int                   `json:"attempts" pg:"attempts,use_zero"`
+	NextAttemptAt int64                 `json:"nextAttemptAt" pg:"nextAttemptAt,use_zero"`
+	// LastStatusCode is the http status code of the last attempt. 0 if no response
+	LastStatusCode int    `json:"lastStatusCode" pg:"lastStatusCode,use_zero"`
+	LastError      string `json:"lastError,omitempty" pg:"lastError"`
+
+	CreatedAt int64 `json:"createdAt" pg:"createdAt"`
+	UpdatedAt int64 `json:"updatedAt" pg:"updatedAt"`
+}
+
+// WebhookAttempt logs an attempt of a webhook delivery
+type WebhookAttempt struct {
+	ID         int64 `json:"id" pg:"id,pk"`
+	DeliveryID int64 `json:"deliveryID" pg:"deliveryID"`
+	// StatusCode of response. 0 if no response
+	StatusCode int    `json:"statusCode" pg:"statusCode,use_zero"`
+	Error      string `json:"error,omitempty" pg:"error"`
+	// Duration of request in milliseconds
+	Duration  int64 `json:"duration" pg:"duration,use_zero"`
+	CreatedAt int64 `json:"createdAt" pg:"createdAt"`
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package moderation
+
+import (
+	"context"
+	"time"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidFlag is returned for flags with unknown status, or without reason or operator
+var ErrInvalidFlag = errors.New("invalid moderation flag")
+
+// Moderator hides or disputes indexed depositories off-chain. Every change is audited as a flag.
+type Moderator struct {
+	db *pg.DB
+}
+
+func NewModerator(db *pg.DB) *Moderator {
+	return &Moderator{db: db}
+}
+
+// Flag changes the moderation status of depository kid. pg.ErrNoRows if kid is not indexed
+func (m *Moderator) Flag(kid string, status models.ModerationStatus, reason string, operator string) (models.ModerationFlag, error) {
+	flag := models.ModerationFlag{
+		KID:       kid,
+		Status:    status,
+		Reason:    reason,
+		Operator:  operator,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := validate(flag); err != nil {
+		return flag, err
+	}
+	exists, err := m.db.Model((*models.Depository)(nil)).Where("kid = ?", kid).Exists()
+	if err != nil {
+		return flag, err
+	}
+	if !exists {
+		return flag, pg.ErrNoRows
+	}
+
+	err = m.db.RunInTransaction(context.TODO(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&flag).Insert(); err != nil {
+			return errors.Wrap(err, "insert moderation flag")
+		}
+		if status == models.ModerationRestored {
+			_, err := tx.Model(&models.Moderation{KID: kid}).WherePK().Delete()
+			return errors.Wrap(err, "delete moderation")
+		}
+		_, err := tx.Model(&models.Moderation{
+			KID:       kid,
+			Status:    status,
+			Reason:    reason,
+			Operator:  operator,
+			UpdatedAt: flag.CreatedAt,
+		}).OnConflict("(kid) DO UPDATE").
+			Set("status = EXCLUDED.status").
+			Set("reason = EXCLUDED.reason").
+			Set("operator = EXCLUDED.operator").
+			Set(`"updatedAt" = EXCLUDED."updatedAt"`).
+			Insert()
+		return errors.Wrap(err, "upsert moderation")
+	})
+	return flag, err
+}
+
+// Get the current moderation of depository kid. pg.ErrNoRows if it is not moderated
+func (m *Moderator) Get(kid string) (models.Moderation, error) {
+	moderation := models.Moderation{KID: kid}
+	err := m.db.Model(&moderation).WherePK().Select()
+	return moderation, err
+}
+
+// List moderated depositories in status, or in all status if empty, latest first
+func (m *Moderator) List(status models.ModerationStatus, from, size int) ([]models.Moderation, int64, error) {
+	moderations := make([]models.Moderation, 0)
+	q := m.db.Model(&moderations).OrderExpr(`"updatedAt" DESC, kid ASC`).Offset(from).Limit(size)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	count, err := q.SelectAndCount()
+	return moderations, int64(count), err
+}
+
+// ListFlags lists the audit of depository kid, latest first
+func (m *Moderator) ListFlags(kid string, from, size int) ([]models.ModerationFlag, int64, error) {
+	flags := make([]models.ModerationFlag, 0)
+	count, err := m.db.Model(&flags).Where("kid = ?", kid).Order("id DESC").Offset(from).Limit(size).SelectAndCount()
+	return flags, int64(count), err
+}
+
+func validate(flag models.ModerationFlag) error {
+	switch flag.Status {
+	case models.ModerationHidden, models.ModerationDisputed, models.ModerationRestored:
+	default:
+		return errors.Wrapf(ErrInvalidFlag, "unknown status %q", flag.Status)
+	}
+	if flag.Reason == "" {
+		return errors.Wrap(ErrInvalidFlag, "empty reason")
+	}
+	if flag.Operator == "" {
+		return errors.Wrap(ErrInvalidFlag, "empty operator")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package moderation
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+// TestValidate tests flags require a known status, a reason and an operator
+func TestValidate(t *testing.T) {
+	flag := models.ModerationFlag{KID: "kid", Status: models.ModerationHidden, Reason: "illegal content", Operator: "admin"}
+	assert.NoError(t, validate(flag))
+
+	for _, invalid := range []models.ModerationFlag{
+		{KID: "kid", Status: "deleted", Reason: "illegal content", Operator: "admin"},
+		{KID: "kid", Status: models.ModerationDisputed, Operator: "admin"},
+		{KID: "kid", Status: models.ModerationRestored, Reason: "resolved"},
+	} {
+		assert.True(t, errors.Is(validate(invalid), ErrInvalidFlag), invalid)
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	// pure go driver, so the image is still built without cgo
+	_ "modernc.org/sqlite"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+// migrations creates the schema step by step. Version of applied ones is kept in PRAGMA user_version.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS depositories (
+		"index" TEXT NOT NULL DEFAULT '',
+		kid TEXT PRIMARY KEY,
+		platform TEXT NOT NULL DEFAULT '',
+		operator TEXT NOT NULL DEFAULT '',
+		owner TEXT NOT NULL DEFAULT '',
+		"blockNumber" INTEGER NOT NULL DEFAULT 0,
+		"transactionID" TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		"contentName" TEXT NOT NULL DEFAULT '',
+		"contentID" TEXT NOT NULL DEFAULT '',
+		"contentType" TEXT NOT NULL DEFAULT '',
+		"trustedTimestamp" INTEGER NOT NULL DEFAULT 0,
+		"contentSize" INTEGER NOT NULL DEFAULT 0,
+		description TEXT NOT NULL DEFAULT '',
+		"ingestedAt" INTEGER NOT NULL DEFAULT 0,
+		"timestampToken" BLOB,
+		"timestampTokenTime" INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS depositories_trusted_timestamp_idx ON depositories ("trustedTimestamp");
+	CREATE INDEX IF NOT EXISTS depositories_content_id_idx ON depositories ("contentID");
+	CREATE INDEX IF NOT EXISTS depositories_owner_idx ON depositories (owner);
+	CREATE INDEX IF NOT EXISTS depositories_block_number_idx ON depositories ("blockNumber");
+	CREATE TABLE IF NOT EXISTS checkpoints (
+		channel TEXT NOT NULL,
+		contract TEXT NOT NULL,
+		"blockNumber" INTEGER NOT NULL DEFAULT 0,
+		"transactionID" TEXT NOT NULL DEFAULT '',
+		"updatedAt" INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (channel, contract)
+	);`,
+	`CREATE INDEX IF NOT EXISTS depositories_transaction_id_idx ON depositories ("transactionID");
+	CREATE INDEX IF NOT EXISTS depositories_operator_idx ON depositories (operator);
+	CREATE INDEX IF NOT EXISTS depositories_platform_idx ON depositories (platform);
+	CREATE INDEX IF NOT EXISTS depositories_content_type_idx ON depositories ("contentType");
+	CREATE INDEX IF NOT EXISTS depositories_content_size_idx ON depositories ("contentSize");`,
+}
+
+const depositoryColumns = `"index", kid, platform, operator, owner, "blockNumber", "transactionID", name, "contentName", "contentID", "contentType", "trustedTimestamp", "contentSize", description, "ingestedAt", "timestampToken", "timestampTokenTime"`
+
+// Store keeps the depository index and checkpoints in an embedded SQLite database.
+// It serves small deployments and local development without PostgreSQL.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database file at path and migrates its schema
+func Open(path string) (*Store, error) {
+	// with WAL, long reads such as exports don't block the listener, and busy timeout waits for other writers
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, errors.Wrap(err, "open sqlite")
+	}
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return errors.Wrap(err, "get schema version")
+	}
+	for v := version; v < len(migrations); v++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "begin migration")
+		}
+		if _, err := tx.Exec(migrations[v]); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "apply migration %d", v+1)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, v+1)); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "apply migration %d", v+1)
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrapf(err, "apply migration %d", v+1)
+		}
+		klog.Infof("[Success] sqlite schema migrated to version %d", v+1)
+	}
+	return nil
+}
+
+// CountDepositories returns the number of depositories matching all conditions.
+// Conditions are sql expressions with ? placeholders.
+func (s *Store) CountDepositories(cond []string, params []interface{}) (int64, error) {
+	var count int64
+	if err := s.db.QueryRow(`SELECT count(*) FROM depositories`+where(cond), params...).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "count depositories")
+	}
+	return count, nil
+}
+
+// ListDepositories returns depositories matching all conditions in order. All are returned if size is 0.
+func (s *Store) ListDepositories(cond []string, params []interface{}, order string, from, size int) ([]models.Depository, error) {
+	query := `SELECT ` + depositoryColumns + ` FROM depositories` + where(cond) + ` ORDER BY ` + order
+	if size != 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", size, from)
+	} else if from != 0 {
+		query += fmt.Sprintf(" LIMIT -1 OFFSET %d", from)
+	}
+	result := make([]models.Depository, 0)
+	err := s.each(query, params, func(d *models.Depository) error {
+		result = append(result, *d)
+		return nil
+	})
+	return result, err
+}
+
+// EachDepository calls fn with each depository matching all conditions in order, without loading all of them
+func (s *Store) EachDepository(cond []string, params []interface{}, order string, fn func(d *models.Depository) error) error {
+	return s.each(`SELECT `+depositoryColumns+` FROM depositories`+where(cond)+` ORDER BY `+order, params, fn)
+}
+
+func (s *Store) each(query string, params []interface{}, fn func(d *models.Depository) error) error {
+	rows, err := s.db.Query(query, params...)
+	if err != nil {
+		return errors.Wrap(err, "query depositories")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d, err := scanDepository(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(&d); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Aggregate is the number and total content size of depositories with the same key
+type Aggregate struct {
+	Key         string
+	Count       int64
+	ContentSize int64
+}
+
+// AggregateDepositories aggregates depositories matching all conditions by column, the most first.
+// All are aggregated into one if column is empty. At most limit aggregates are returned if it is positive.
+func (s *Store) AggregateDepositories(cond []string, params []interface{}, column string, limit int) ([]Aggregate, error) {
+	key := `''`
+	if column != "" {
+		key = `CAST(` + column + ` AS TEXT)`
+	}
+	query := `SELECT ` + key + ` AS key, count(*), coalesce(sum("contentSize"), 0) FROM depositories` + where(cond)
+	if column != "" {
+		query += ` GROUP BY key ORDER BY count(*) DESC, key`
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := s.db.Query(query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "aggregate depositories")
+	}
+	defer rows.Close()
+	result := make([]Aggregate, 0)
+	for rows.Next() {
+		a := Aggregate{}
+		if err := rows.Scan(&a.Key, &a.Count, &a.ContentSize); err != nil {
+			return nil, errors.Wrap(err, "scan aggregate")
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// GetDepository returns the first depository matching all conditions. sql.ErrNoRows is returned if none.
+func (s *Store) GetDepository(cond []string, params []interface{}) (models.Depository, error) {
+	row := s.db.QueryRow(`SELECT `+depositoryColumns+` FROM depositories`+where(cond)+` LIMIT 1`, params...)
+	return scanDepository(row)
+}
+
+func where(cond []string) string {
+	if len(cond) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(cond, " AND ")
+}
+
+func scanDepository(row interface{ Scan(...interface{}) error }) (models.Depository, error) {
+	d := models.Depository{}
+	err := row.Scan(&d.Index, &d.KID, &d.Platform, &d.Operator, &d.Owner, &d.BlockNumber, &d.TransactionID,
+		&d.Name, &d.ContentName, &d.ContentID, &d.ContentType, &d.TrustedTimestamp, &d.ContentSize,
+		&d.Description, &d.IngestedAt, &d.TimestampToken, &d.TimestampTokenTime)
+	if err == sql.ErrNoRows {
+		return d, err
+	}
+	return d, errors.Wrap(err, "scan depository")
+}
+
+// Checkpoint returns the checkpoint of contract in channel. A zero one is returned if no event has been processed.
+func (s *Store) Checkpoint(channel, contract string) (models.Checkpoint, error) {
+	checkpoint := models.Checkpoint{Channel: channel, Contract: contract}
+	err := s.db.QueryRow(`SELECT "blockNumber", "transactionID", "updatedAt" FROM checkpoints WHERE channel = ? AND contract = ?`, channel, contract).
+		Scan(&checkpoint.BlockNumber, &checkpoint.TransactionID, &checkpoint.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return checkpoint, errors.Wrap(err, "load checkpoint")
+	}
+	return checkpoint, nil
+}
+
+// Commit inserts depositories and saves checkpoint in one transaction.
+// Depositories which are indexed already are kept as is.
+func (s *Store) Commit(depositories []*models.Depository, checkpoint models.Checkpoint) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+	for _, d := range depositories {
+		_, err := tx.Exec(`INSERT INTO depositories (`+depositoryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (kid) DO NOTHING`,
+			d.Index, d.KID, d.Platform, d.Operator, d.Owner, int64(d.BlockNumber), d.TransactionID,
+			d.Name, d.ContentName, d.ContentID, d.ContentType, d.TrustedTimestamp, d.ContentSize,
+			d.Description, d.IngestedAt, d.TimestampToken, d.TimestampTokenTime)
+		if err != nil {
+			return errors.Wrapf(err, "insert depository %s", d.KID)
+		}
+	}
+	if checkpoint.UpdatedAt == 0 {
+		checkpoint.UpdatedAt = time.Now().Unix()
+	}
+	_, err = tx.Exec(`INSERT INTO checkpoints (channel, contract, "blockNumber", "transactionID", "updatedAt") VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (channel, contract) DO UPDATE SET "blockNumber" = excluded."blockNumber", "transactionID" = excluded."transactionID", "updatedAt" = excluded."updatedAt"`,
+		checkpoint.Channel, checkpoint.Contract, int64(checkpoint.BlockNumber), checkpoint.TransactionID, checkpoint.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "save checkpoint")
+	}
+	return errors.Wrap(tx.Commit(), "commit transaction")
+}
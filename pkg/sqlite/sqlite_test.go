@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+// TestStore tests committing depositories with checkpoints and querying them
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bc-saas.db")
+	s, err := Open(path)
+	require.NoError(t, err)
+
+	checkpoint, err := s.Checkpoint("channel", "depository")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), checkpoint.BlockNumber)
+
+	checkpoint.BlockNumber = 3
+	checkpoint.TransactionID = "tx2"
+	require.NoError(t, s.Commit([]*models.Depository{
+		{KID: "kid1", Name: "dep1", ContentName: "report.pdf", BlockNumber: 2, TransactionID: "tx1", TrustedTimestamp: 100, TimestampToken: []byte{1, 2}},
+		{KID: "kid2", Name: "dep2", ContentName: "photo.jpg", BlockNumber: 3, TransactionID: "tx2", TrustedTimestamp: 200},
+	}, checkpoint))
+	// indexed depositories are kept as is
+	require.NoError(t, s.Commit([]*models.Depository{{KID: "kid1", Name: "changed"}}, checkpoint))
+
+	// schema is not migrated twice
+	require.NoError(t, s.Close())
+	s, err = Open(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	checkpoint, err = s.Checkpoint("channel", "depository")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), checkpoint.BlockNumber)
+	assert.Equal(t, "tx2", checkpoint.TransactionID)
+
+	count, err := s.CountDepositories(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	result, err := s.ListDepositories(nil, nil, `"trustedTimestamp" desc`, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, "kid2", result[0].KID)
+
+	result, err = s.ListDepositories([]string{`"contentName" like ?`}, []interface{}{"%report%"}, `kid`, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, "dep1", result[0].Name)
+	assert.Equal(t, []byte{1, 2}, result[0].TimestampToken)
+
+	d, err := s.GetDepository([]string{`kid=?`}, []interface{}{"kid2"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), d.BlockNumber)
+	_, err = s.GetDepository([]string{`kid=?`}, []interface{}{"kid3"})
+	assert.Equal(t, sql.ErrNoRows, err)
+}
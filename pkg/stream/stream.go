@@ -0,0 +1,413 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package stream broadcasts indexed depositories to live subscribers
+package stream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+const (
+	// EventDepositoryCreated is sent once a depository is indexed
+	EventDepositoryCreated = "depository.created"
+
+	// max length of a postgres identifier
+	maxChannelLength = 63
+	subscriberBuffer = 64
+	backlogPageSize  = 100
+	heartbeat        = 15 * time.Second
+
+	// MaxBacklog is the max number of depositories after Last-Event-ID to resume from
+	MaxBacklog = 1000
+)
+
+var (
+	// ErrSlowSubscriber is returned by Stream when the subscriber can't keep up with
+	// indexed depositories. It should reconnect with the last received event id.
+	ErrSlowSubscriber = errors.New("subscriber is too slow")
+	// ErrBacklogTooLarge is returned by CheckBacklog when more than MaxBacklog depositories
+	// are indexed after the last event id. They should be listed instead.
+	ErrBacklogTooLarge = errors.Errorf("more than %d depositories after the last event id", MaxBacklog)
+
+	subscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bc_saas",
+		Subsystem: "stream",
+		Name:      "subscribers",
+		Help:      "Number of live depository event subscribers",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(subscribers)
+}
+
+// Position of a depository in ledger. It is used as the id of events.
+type Position struct {
+	BlockNumber   uint64
+	TransactionID string
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d-%s", p.BlockNumber, p.TransactionID)
+}
+
+// ParsePosition parses an event id in format {blockNumber}-{transactionID}
+func ParsePosition(id string) (Position, error) {
+	block, txID, found := strings.Cut(id, "-")
+	if !found || txID == "" {
+		return Position{}, errors.Errorf("invalid event id %s", id)
+	}
+	blockNumber, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		return Position{}, errors.Errorf("invalid event id %s", id)
+	}
+	return Position{BlockNumber: blockNumber, TransactionID: txID}, nil
+}
+
+// Event of an indexed depository
+type Event struct {
+	ID         string
+	Type       string
+	Depository *models.Depository
+}
+
+func newEvent(d *models.Depository) *Event {
+	return &Event{
+		ID:         Position{BlockNumber: d.BlockNumber, TransactionID: d.TransactionID}.String(),
+		Type:       EventDepositoryCreated,
+		Depository: d,
+	}
+}
+
+// Visibility decides whether depository d can be seen by u. Moderation of d is set.
+// u is nil when authentication is disabled.
+type Visibility func(u user.Info, d *models.Depository) bool
+
+// Filter of depositories sent to a subscriber
+type Filter struct {
+	Owner    string
+	Platform string
+	KID      string
+	// Accounts limits depositories to those owned or operated by them. All if nil
+	Accounts []string
+
+	User       user.Info
+	Visibility Visibility
+}
+
+// Match returns true if d passes f
+func (f Filter) Match(d *models.Depository) bool {
+	if f.Owner != "" && f.Owner != d.Owner {
+		return false
+	}
+	if f.Platform != "" && f.Platform != d.Platform {
+		return false
+	}
+	if f.KID != "" && f.KID != d.KID {
+		return false
+	}
+	if f.Accounts != nil && !contains(f.Accounts, d.Owner) && !contains(f.Accounts, d.Operator) {
+		return false
+	}
+	if f.Visibility != nil && !f.Visibility(f.User, d) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type subscriber struct {
+	events chan *Event
+	// closed when subscriber is dropped for being slow
+	dropped chan struct{}
+}
+
+// Broker broadcasts depositories once their transactions are committed.
+// Notifications go through postgres LISTEN/NOTIFY, so subscribers of every replica receive them.
+type Broker struct {
+	db      *pg.DB
+	channel string
+
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+}
+
+// NewBroker creates a broker which notifies with postgres channel
+func NewBroker(db *pg.DB, channel string) *Broker {
+	if len(channel) > maxChannelLength {
+		sum := sha256.Sum256([]byte(channel))
+		channel = "depositories_" + hex.EncodeToString(sum[:16])
+	}
+	return &Broker{
+		db:          db,
+		channel:     channel,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// DepositoryCreated notifies depository d with db, which is the transaction that inserts d.
+// Postgres delivers the notification only if db is committed.
+func (b *Broker) DepositoryCreated(db orm.DB, depository *models.Depository) error {
+	_, err := db.Exec(`SELECT pg_notify(?, ?)`, b.channel, depository.KID)
+	return errors.Wrap(err, "notify depository")
+}
+
+// Run listens notifications and broadcasts notified depositories until ctx is done
+func (b *Broker) Run(ctx context.Context) {
+	ln := b.db.Listen(ctx, b.channel)
+	defer ln.Close()
+	klog.Infof("[Success] Listening depository notifications on %s", b.channel)
+
+	ch := ln.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-ch:
+			if !ok {
+				return
+			}
+			depository := &models.Depository{KID: n.Payload}
+			if err := b.db.Model(depository).WherePK().Select(); err != nil {
+				klog.Errorf("[Error] Load notified depository %s error %s", n.Payload, err)
+				continue
+			}
+			// a reindexed depository may have been moderated
+			if err := b.moderate(ctx, []*models.Depository{depository}); err != nil {
+				klog.Errorf("[Error] Load moderation of notified depository %s error %s", n.Payload, err)
+				continue
+			}
+			b.publish(newEvent(depository))
+		}
+	}
+}
+
+func (b *Broker) publish(e *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		select {
+		case s.events <- e:
+		default:
+			klog.Warningf("Drop slow subscriber of depository events")
+			b.remove(s)
+		}
+	}
+}
+
+func (b *Broker) subscribe() *subscriber {
+	s := &subscriber{
+		events:  make(chan *Event, subscriberBuffer),
+		dropped: make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+	subscribers.Inc()
+	return s
+}
+
+func (b *Broker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+}
+
+// remove must be called with b.mu held
+func (b *Broker) remove(s *subscriber) {
+	if _, ok := b.subscribers[s]; !ok {
+		return
+	}
+	delete(b.subscribers, s)
+	close(s.dropped)
+	subscribers.Dec()
+}
+
+// Stream sends events which pass filter to send until ctx is done or send fails.
+// With from, indexed depositories after it are sent first. Events in the same block of from
+// may be sent again since transactions in a block are not ordered in index.
+// send is called with a nil event every 15 seconds as a heartbeat.
+func (b *Broker) Stream(ctx context.Context, filter Filter, from *Position, send func(*Event) error) error {
+	// subscribe before sending backlog, so no depository is missed in between
+	s := b.subscribe()
+	defer b.unsubscribe(s)
+
+	var last *Position
+	lastTxs := make(map[string]bool)
+	if from != nil {
+		var err error
+		last, lastTxs, err = b.backlog(ctx, filter, *from, send)
+		if err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.dropped:
+			return ErrSlowSubscriber
+		case <-ticker.C:
+			if err := send(nil); err != nil {
+				return err
+			}
+		case e := <-s.events:
+			d := e.Depository
+			// skip those already sent in backlog
+			if last != nil && (d.BlockNumber < last.BlockNumber || (d.BlockNumber == last.BlockNumber && lastTxs[d.TransactionID])) {
+				continue
+			}
+			if !filter.Match(d) {
+				continue
+			}
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// backlog sends indexed depositories from position from. It returns the last sent position
+// and transactions sent in that block.
+func (b *Broker) backlog(ctx context.Context, filter Filter, from Position, send func(*Event) error) (*Position, map[string]bool, error) {
+	last := &from
+	lastTxs := map[string]bool{from.TransactionID: true}
+	offset := 0
+	for {
+		depositories := make([]*models.Depository, 0, backlogPageSize)
+		query := b.after(b.db.ModelContext(ctx, &depositories), filter, from).
+			Order("blockNumber ASC", "transactionID ASC").
+			Offset(offset).
+			Limit(backlogPageSize)
+		if err := query.Select(); err != nil {
+			return nil, nil, errors.Wrap(err, "select depositories after last event")
+		}
+		if err := b.moderate(ctx, depositories); err != nil {
+			return nil, nil, err
+		}
+		for _, d := range depositories {
+			if d.BlockNumber != last.BlockNumber {
+				last = &Position{BlockNumber: d.BlockNumber, TransactionID: d.TransactionID}
+				lastTxs = make(map[string]bool)
+			}
+			lastTxs[d.TransactionID] = true
+			if !filter.Match(d) {
+				continue
+			}
+			if err := send(newEvent(d)); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(depositories) < backlogPageSize {
+			return last, lastTxs, nil
+		}
+		offset += len(depositories)
+		// depositories may be indexed after CheckBacklog
+		if offset > MaxBacklog {
+			return nil, nil, ErrBacklogTooLarge
+		}
+	}
+}
+
+// CheckBacklog returns ErrBacklogTooLarge if more than MaxBacklog depositories passing filter
+// are indexed after from, so that a stream can't be used to dump the whole index
+func (b *Broker) CheckBacklog(ctx context.Context, filter Filter, from Position) error {
+	kids := make([]string, 0)
+	err := b.after(b.db.ModelContext(ctx, (*models.Depository)(nil)), filter, from).
+		Column("kid").
+		Limit(MaxBacklog + 1).
+		Select(&kids)
+	if err != nil {
+		return errors.Wrap(err, "count depositories after last event")
+	}
+	if len(kids) > MaxBacklog {
+		return ErrBacklogTooLarge
+	}
+	return nil
+}
+
+// after selects depositories passing filter after position from with q
+func (b *Broker) after(q *orm.Query, filter Filter, from Position) *orm.Query {
+	q = q.Where(`"blockNumber" >= ?`, from.BlockNumber).
+		Where(`NOT ("blockNumber" = ? AND "transactionID" = ?)`, from.BlockNumber, from.TransactionID)
+	if filter.Owner != "" {
+		q = q.Where("owner = ?", filter.Owner)
+	}
+	if filter.Platform != "" {
+		q = q.Where("platform = ?", filter.Platform)
+	}
+	if filter.KID != "" {
+		q = q.Where("kid = ?", filter.KID)
+	}
+	if filter.Accounts != nil {
+		if len(filter.Accounts) == 0 {
+			return q.Where("false")
+		}
+		q = q.Where("(owner IN (?) OR operator IN (?))", pg.In(filter.Accounts), pg.In(filter.Accounts))
+	}
+	return q
+}
+
+// moderate sets moderation status of depositories
+func (b *Broker) moderate(ctx context.Context, depositories []*models.Depository) error {
+	if len(depositories) == 0 {
+		return nil
+	}
+	kids := make([]string, len(depositories))
+	for i, d := range depositories {
+		kids[i] = d.KID
+	}
+	moderations := make([]models.Moderation, 0)
+	if err := b.db.ModelContext(ctx, &moderations).Column("kid", "status").Where("kid IN (?)", pg.In(kids)).Select(); err != nil {
+		return errors.Wrap(err, "select moderations")
+	}
+	status := make(map[string]models.ModerationStatus, len(moderations))
+	for _, m := range moderations {
+		status[m.KID] = m.Status
+	}
+	for _, d := range depositories {
+		d.Moderation = status[d.KID]
+	}
+	return nil
+}
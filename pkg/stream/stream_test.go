@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+func TestParsePosition(t *testing.T) {
+	p, err := ParsePosition("12-abc-def")
+	require.NoError(t, err)
+	assert.Equal(t, Position{BlockNumber: 12, TransactionID: "abc-def"}, p)
+	assert.Equal(t, "12-abc-def", p.String())
+
+	for _, id := range []string{"", "12", "12-", "x-abc"} {
+		_, err = ParsePosition(id)
+		assert.Error(t, err, id)
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	d := &models.Depository{KID: "kid1", Owner: "owner1", Platform: "p1"}
+	assert.True(t, Filter{}.Match(d))
+	assert.True(t, Filter{Owner: "owner1", Platform: "p1", KID: "kid1"}.Match(d))
+	assert.False(t, Filter{Owner: "owner2"}.Match(d))
+	assert.False(t, Filter{Platform: "p2"}.Match(d))
+	assert.False(t, Filter{KID: "kid2"}.Match(d))
+	assert.True(t, Filter{Accounts: []string{"operator1", "owner1"}}.Match(d))
+	assert.False(t, Filter{Accounts: []string{"owner2"}}.Match(d))
+	assert.False(t, Filter{Accounts: []string{}}.Match(d))
+
+	onlyAlice := func(u user.Info, d *models.Depository) bool {
+		return u != nil && u.GetName() == "alice"
+	}
+	assert.True(t, Filter{User: &user.DefaultInfo{Name: "alice"}, Visibility: onlyAlice}.Match(d))
+	assert.False(t, Filter{User: &user.DefaultInfo{Name: "bob"}, Visibility: onlyAlice}.Match(d))
+	assert.False(t, Filter{Visibility: onlyAlice}.Match(d))
+}
+
+func TestBroker_Stream(t *testing.T) {
+	b := NewBroker(nil, "depositories")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan *Event, 2)
+	done := make(chan error)
+	go func() {
+		done <- b.Stream(ctx, Filter{Owner: "owner1"}, nil, func(e *Event) error {
+			if e != nil {
+				received <- e
+			}
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+		return len(b.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	b.publish(newEvent(&models.Depository{KID: "kid1", Owner: "owner2", BlockNumber: 1, TransactionID: "tx1"}))
+	b.publish(newEvent(&models.Depository{KID: "kid2", Owner: "owner1", BlockNumber: 2, TransactionID: "tx2"}))
+	e := <-received
+	assert.Equal(t, "2-tx2", e.ID)
+	assert.Equal(t, EventDepositoryCreated, e.Type)
+	assert.Equal(t, "kid2", e.Depository.KID)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, b.subscribers)
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := NewBroker(nil, "depositories")
+	s := b.subscribe()
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.publish(newEvent(&models.Depository{KID: "kid"}))
+	}
+	select {
+	case <-s.dropped:
+	default:
+		t.Fatal("slow subscriber is not dropped")
+	}
+	assert.Empty(t, b.subscribers)
+	// unsubscribe after dropped is a no-op
+	b.unsubscribe(s)
+}
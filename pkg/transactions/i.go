@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transactions
+
+import (
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+type TransactionCond struct {
+	From, Size int
+	// TransactionID, CreatorMSP, Function and ValidationCode match exactly
+	TransactionID, CreatorMSP, Function, ValidationCode string
+	// Valid filters valid or invalid transactions if not nil
+	Valid              *bool
+	StartTime, EndTime int64
+}
+
+func (tc *TransactionCond) ToCond() ([]string, []interface{}) {
+	params := make([]interface{}, 0)
+	cond := make([]string, 0)
+	if tc.TransactionID != "" {
+		cond = append(cond, `"transactionID"=?`)
+		params = append(params, tc.TransactionID)
+	}
+	if tc.CreatorMSP != "" {
+		cond = append(cond, `"creatorMSP"=?`)
+		params = append(params, tc.CreatorMSP)
+	}
+	if tc.Function != "" {
+		cond = append(cond, `"function"=?`)
+		params = append(params, tc.Function)
+	}
+	if tc.ValidationCode != "" {
+		cond = append(cond, `"validationCode"=?`)
+		params = append(params, tc.ValidationCode)
+	}
+	if tc.Valid != nil {
+		cond = append(cond, `"valid"=?`)
+		params = append(params, *tc.Valid)
+	}
+	if tc.StartTime > 0 {
+		cond = append(cond, `"timestamp">=?`)
+		params = append(params, tc.StartTime)
+	}
+	if tc.EndTime > 0 {
+		cond = append(cond, `"timestamp"<=?`)
+		params = append(params, tc.EndTime)
+	}
+	return cond, params
+}
+
+type Interface interface {
+	List(TransactionCond) ([]models.Transaction, int64, error)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tsa requests and verifies RFC 3161 timestamp tokens from a timestamp authority
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+	"github.com/pkg/errors"
+)
+
+const (
+	contentTypeQuery = "application/timestamp-query"
+
+	defaultTimeout = 10 * time.Second
+)
+
+var (
+	// ErrImprintMismatch is returned when a token does not attest the given data
+	ErrImprintMismatch = errors.New("message imprint mismatch")
+	// ErrNonceMismatch is returned when a TSA replies with a different nonce
+	ErrNonceMismatch = errors.New("nonce mismatch")
+	// ErrNoCertificate is returned when a token does not embed the TSA certificate
+	ErrNoCertificate = errors.New("no tsa certificate in token")
+)
+
+// Client talks to a timestamp authority over HTTP
+type Client struct {
+	url        string
+	httpClient *http.Client
+	// roots to verify tsa certificates. nil means only token signatures are verified
+	roots *x509.CertPool
+}
+
+// NewClient creates a client for the TSA at url. caFile is an optional PEM bundle
+// used to verify the certificate chain of TSA.
+func NewClient(url string, caFile string) (*Client, error) {
+	if url == "" {
+		return nil, errors.New("empty tsa url")
+	}
+	c := &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		c.roots = x509.NewCertPool()
+		if !c.roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+	}
+	return c, nil
+}
+
+// Stamp requests a timestamp token which attests the SHA-256 digest of data.
+// The token in DER form is returned together with its parsed content.
+func (c *Client) Stamp(data []byte) (*timestamp.Timestamp, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := timestamp.CreateRequest(bytes.NewReader(data), &timestamp.RequestOptions{
+		Hash:         crypto.SHA256,
+		Certificates: true,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create timestamp request")
+	}
+
+	resp, err := c.httpClient.Post(c.url, contentTypeQuery, bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.Wrap(err, "request tsa")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read tsa response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tsa responds with status %d", resp.StatusCode)
+	}
+
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse tsa response")
+	}
+	if ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		return nil, ErrNonceMismatch
+	}
+	if err := verify(ts, data, c.roots); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Trusted returns true if roots are configured. Without them, anyone can sign a token
+// with a self-signed certificate, so verified tokens can't be trusted.
+func (c *Client) Trusted() bool {
+	return c != nil && c.roots != nil
+}
+
+// Verify verifies token with roots configured in client
+func (c *Client) Verify(token []byte, data []byte) (*timestamp.Timestamp, error) {
+	return Verify(token, data, c.roots)
+}
+
+// Verify checks that token is correctly signed by a TSA and attests data.
+// If roots is not nil, the TSA certificate must chain to one of them.
+func Verify(token []byte, data []byte, roots *x509.CertPool) (*timestamp.Timestamp, error) {
+	// signature is checked by Parse when certificates are embedded
+	ts, err := timestamp.Parse(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse timestamp token")
+	}
+	if err := verify(ts, data, roots); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func verify(ts *timestamp.Timestamp, data []byte, roots *x509.CertPool) error {
+	if len(ts.Certificates) == 0 {
+		return ErrNoCertificate
+	}
+	if !ts.HashAlgorithm.Available() {
+		return fmt.Errorf("hash algorithm %s not available", ts.HashAlgorithm)
+	}
+	h := ts.HashAlgorithm.New()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), ts.HashedMessage) {
+		return ErrImprintMismatch
+	}
+
+	if roots == nil {
+		return nil
+	}
+	// the certificate which signed the token, other embedded ones may belong to anyone
+	p7, err := pkcs7.Parse(ts.RawToken)
+	if err != nil {
+		return errors.Wrap(err, "parse timestamp token")
+	}
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return ErrNoCertificate
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range ts.Certificates {
+		intermediates.AddCert(cert)
+	}
+	_, err = signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   ts.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return errors.Wrap(err, "verify tsa certificate")
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// localTSA is a stand-in timestamp authority which signs every request with a self-signed certificate
+type localTSA struct {
+	*httptest.Server
+	cert *x509.Certificate
+}
+
+func newLocalTSA(t *testing.T) *localTSA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bc-saas local tsa"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req, err := timestamp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ts := &timestamp.Timestamp{
+			HashAlgorithm:     req.HashAlgorithm,
+			HashedMessage:     req.HashedMessage,
+			Time:              time.Now(),
+			Nonce:             req.Nonce,
+			Policy:            asn1.ObjectIdentifier{1, 2, 3, 4, 1},
+			AddTSACertificate: req.Certificates,
+		}
+		resp, err := ts.CreateResponse(cert, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(resp)
+	}))
+	return &localTSA{Server: server, cert: cert}
+}
+
+func (l *localTSA) writeCA(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: l.cert.Raw}), 0600)
+	require.NoError(t, err)
+	return path
+}
+
+// TestClient_Stamp tests requesting and verifying a token from a TSA
+func TestClient_Stamp(t *testing.T) {
+	tsa := newLocalTSA(t)
+	defer tsa.Close()
+
+	c, err := NewClient(tsa.URL, tsa.writeCA(t))
+	require.NoError(t, err)
+	assert.True(t, c.Trusted())
+
+	data := []byte("content hash")
+	ts, err := c.Stamp(data)
+	require.NoError(t, err)
+	assert.NotEmpty(t, ts.RawToken)
+	assert.WithinDuration(t, time.Now(), ts.Time, time.Minute)
+
+	verified, err := c.Verify(ts.RawToken, data)
+	assert.NoError(t, err)
+	assert.Equal(t, ts.Time.Unix(), verified.Time.Unix())
+}
+
+// TestVerify tests verification of tokens against data and roots
+func TestVerify(t *testing.T) {
+	tsa := newLocalTSA(t)
+	defer tsa.Close()
+
+	c, err := NewClient(tsa.URL, "")
+	require.NoError(t, err)
+	assert.False(t, c.Trusted())
+	assert.False(t, (*Client)(nil).Trusted())
+	ts, err := c.Stamp([]byte("content hash"))
+	require.NoError(t, err)
+
+	// signature only
+	_, err = Verify(ts.RawToken, []byte("content hash"), nil)
+	assert.NoError(t, err)
+
+	// token attests other data
+	_, err = Verify(ts.RawToken, []byte("another content hash"), nil)
+	assert.ErrorIs(t, err, ErrImprintMismatch)
+
+	// tsa not trusted
+	other := newLocalTSA(t)
+	defer other.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(other.cert)
+	_, err = Verify(ts.RawToken, []byte("content hash"), roots)
+	assert.Error(t, err)
+
+	// corrupted token
+	corrupted := append([]byte{}, ts.RawToken...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	_, err = Verify(corrupted, []byte("content hash"), nil)
+	assert.Error(t, err)
+}
+
+// TestVerify_ForgedSigner tests a token signed by an untrusted key is rejected even if
+// the certificate of a trusted TSA is embedded next to the signing certificate
+func TestVerify_ForgedSigner(t *testing.T) {
+	tsa := newLocalTSA(t)
+	defer tsa.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(tsa.cert)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "forged tsa"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	forged, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	data := []byte("content hash")
+	digest := sha256.Sum256(data)
+	ts := &timestamp.Timestamp{
+		HashAlgorithm: crypto.SHA256,
+		HashedMessage: digest[:],
+		Time:          time.Now(),
+		Policy:        asn1.ObjectIdentifier{1, 2, 3, 4, 1},
+	}
+	resp, err := ts.CreateResponse(forged, key)
+	require.NoError(t, err)
+	parsed, err := timestamp.ParseResponse(resp)
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(parsed.RawToken)
+	require.NoError(t, err)
+
+	// signed by the forged key, with the trusted certificate embedded as well
+	sd, err := pkcs7.NewSignedData(p7.Content)
+	require.NoError(t, err)
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	sd.SetContentType(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4})
+	require.NoError(t, sd.AddSigner(forged, key, pkcs7.SignerInfoConfig{}))
+	sd.AddCertificate(tsa.cert)
+	token, err := sd.Finish()
+	require.NoError(t, err)
+
+	forgedTS, err := Verify(token, data, nil)
+	require.NoError(t, err)
+	require.Len(t, forgedTS.Certificates, 2)
+	_, err = Verify(token, data, roots)
+	assert.Error(t, err)
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrNotEndorserTransaction is returned when parsing a config or other non-chaincode transaction
+	ErrNotEndorserTransaction = errors.New("not an endorser transaction")
+)
+
+// PayloadFromEnvelope unmarshals the payload of a transaction envelope
+func PayloadFromEnvelope(env *common.Envelope) (*common.Payload, error) {
+	if env == nil {
+		return nil, errors.New("nil envelope")
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.GetPayload(), payload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal payload")
+	}
+	return payload, nil
+}
+
+// ChannelHeaderFromEnvelope unmarshals the channel header of a transaction envelope
+func ChannelHeaderFromEnvelope(env *common.Envelope) (*common.ChannelHeader, error) {
+	payload, err := PayloadFromEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+	return channelHeader(payload)
+}
+
+func channelHeader(payload *common.Payload) (*common.ChannelHeader, error) {
+	if payload.GetHeader() == nil {
+		return nil, errors.New("missing payload header")
+	}
+	chdr := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), chdr); err != nil {
+		return nil, errors.Wrap(err, "unmarshal channel header")
+	}
+	return chdr, nil
+}
+
+// ChaincodeTransaction is an endorsed chaincode invocation parsed from a transaction envelope
+type ChaincodeTransaction struct {
+	ChannelHeader   *common.ChannelHeader
+	SignatureHeader *common.SignatureHeader
+	// Creator who signed this transaction
+	Creator *msp.SerializedIdentity
+
+	// ChaincodeName is the name of invoked chaincode
+	ChaincodeName string
+	// Args of this invocation. The first one is the function name
+	Args [][]byte
+
+	// ProposalResponsePayload is the payload signed by all endorsers
+	ProposalResponsePayload []byte
+	Endorsements            []*peer.Endorsement
+	// Event emitted by chaincode. Optional
+	Event *peer.ChaincodeEvent
+	// Writes of each namespace
+	Writes map[string][]*kvrwset.KVWrite
+}
+
+// Function returns the invoked function of chaincode
+func (tx *ChaincodeTransaction) Function() string {
+	if len(tx.Args) == 0 {
+		return ""
+	}
+	return string(tx.Args[0])
+}
+
+// ParseChaincodeTransaction parses the chaincode invocation in a transaction envelope
+func ParseChaincodeTransaction(env *common.Envelope) (*ChaincodeTransaction, error) {
+	payload, err := PayloadFromEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+	chdr, err := channelHeader(payload)
+	if err != nil {
+		return nil, err
+	}
+	if common.HeaderType(chdr.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, ErrNotEndorserTransaction
+	}
+	tx := &ChaincodeTransaction{
+		ChannelHeader:   chdr,
+		SignatureHeader: &common.SignatureHeader{},
+		Creator:         &msp.SerializedIdentity{},
+		Writes:          make(map[string][]*kvrwset.KVWrite),
+	}
+	if err = proto.Unmarshal(payload.GetHeader().GetSignatureHeader(), tx.SignatureHeader); err != nil {
+		return nil, errors.Wrap(err, "unmarshal signature header")
+	}
+	if err = proto.Unmarshal(tx.SignatureHeader.GetCreator(), tx.Creator); err != nil {
+		return nil, errors.Wrap(err, "unmarshal creator")
+	}
+
+	peerTx := &peer.Transaction{}
+	if err = proto.Unmarshal(payload.GetData(), peerTx); err != nil {
+		return nil, errors.Wrap(err, "unmarshal transaction")
+	}
+	// fabric always creates one action in a transaction
+	if len(peerTx.GetActions()) == 0 {
+		return nil, errors.New("no action in transaction")
+	}
+	actionPayload := &peer.ChaincodeActionPayload{}
+	if err = proto.Unmarshal(peerTx.GetActions()[0].GetPayload(), actionPayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode action payload")
+	}
+
+	proposalPayload := &peer.ChaincodeProposalPayload{}
+	if err = proto.Unmarshal(actionPayload.GetChaincodeProposalPayload(), proposalPayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode proposal payload")
+	}
+	invocation := &peer.ChaincodeInvocationSpec{}
+	if err = proto.Unmarshal(proposalPayload.GetInput(), invocation); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode invocation spec")
+	}
+	tx.ChaincodeName = invocation.GetChaincodeSpec().GetChaincodeId().GetName()
+	tx.Args = invocation.GetChaincodeSpec().GetInput().GetArgs()
+
+	tx.ProposalResponsePayload = actionPayload.GetAction().GetProposalResponsePayload()
+	tx.Endorsements = actionPayload.GetAction().GetEndorsements()
+	responsePayload := &peer.ProposalResponsePayload{}
+	if err = proto.Unmarshal(tx.ProposalResponsePayload, responsePayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal proposal response payload")
+	}
+	action := &peer.ChaincodeAction{}
+	if err = proto.Unmarshal(responsePayload.GetExtension(), action); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode action")
+	}
+	if tx.ChaincodeName == "" {
+		tx.ChaincodeName = action.GetChaincodeId().GetName()
+	}
+	if len(action.GetEvents()) > 0 {
+		tx.Event = &peer.ChaincodeEvent{}
+		if err = proto.Unmarshal(action.GetEvents(), tx.Event); err != nil {
+			return nil, errors.Wrap(err, "unmarshal chaincode event")
+		}
+	}
+
+	results := &rwset.TxReadWriteSet{}
+	if err = proto.Unmarshal(action.GetResults(), results); err != nil {
+		return nil, errors.Wrap(err, "unmarshal read write set")
+	}
+	for _, nsRWSet := range results.GetNsRwset() {
+		kvRWSet := &kvrwset.KVRWSet{}
+		if err = proto.Unmarshal(nsRWSet.GetRwset(), kvRWSet); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal read write set of %s", nsRWSet.GetNamespace())
+		}
+		tx.Writes[nsRWSet.GetNamespace()] = kvRWSet.GetWrites()
+	}
+
+	return tx, nil
+}
+
+// BlockHeaderBytes returns the ASN.1 encoding of a block header, which is signed by orderers
+func BlockHeaderBytes(header *common.BlockHeader) []byte {
+	result, err := asn1.Marshal(struct {
+		Number       *big.Int
+		PreviousHash []byte
+		DataHash     []byte
+	}{
+		Number:       new(big.Int).SetUint64(header.GetNumber()),
+		PreviousHash: header.GetPreviousHash(),
+		DataHash:     header.GetDataHash(),
+	})
+	if err != nil {
+		// asn1 encoding of integers and bytes never fails
+		panic(err)
+	}
+	return result
+}
+
+// BlockHeaderHash returns the hash of a block header, which is referred as PreviousHash by next block
+func BlockHeaderHash(header *common.BlockHeader) []byte {
+	sum := sha256.Sum256(BlockHeaderBytes(header))
+	return sum[:]
+}
+
+// BlockDataHash returns the hash of block data, which is recorded as DataHash in block header
+func BlockDataHash(data *common.BlockData) []byte {
+	h := sha256.New()
+	for _, d := range data.GetData() {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// TxValidationCode returns the validation code of the i-th transaction in block
+func TxValidationCode(block *common.Block, i int) peer.TxValidationCode {
+	filter := block.GetMetadata().GetMetadata()
+	if len(filter) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		return peer.TxValidationCode_NOT_VALIDATED
+	}
+	codes := filter[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	if i >= len(codes) {
+		return peer.TxValidationCode_NOT_VALIDATED
+	}
+	return peer.TxValidationCode(codes[i])
+}
+
+// BlockSignatures returns the metadata which carries orderers' signatures on block
+func BlockSignatures(block *common.Block) (*common.Metadata, error) {
+	metadata := block.GetMetadata().GetMetadata()
+	if len(metadata) <= int(common.BlockMetadataIndex_SIGNATURES) {
+		return nil, errors.New("no signatures in block metadata")
+	}
+	signatures := &common.Metadata{}
+	if err := proto.Unmarshal(metadata[common.BlockMetadataIndex_SIGNATURES], signatures); err != nil {
+		return nil, errors.Wrap(err, "unmarshal block signatures")
+	}
+	return signatures, nil
+}
+
+// LastConfigIndex returns the number of the latest config block when block was created
+func LastConfigIndex(block *common.Block) (uint64, error) {
+	signatures, err := BlockSignatures(block)
+	if err != nil {
+		return 0, err
+	}
+	obm := &common.OrdererBlockMetadata{}
+	if err = proto.Unmarshal(signatures.GetValue(), obm); err == nil && obm.GetLastConfig() != nil {
+		return obm.GetLastConfig().GetIndex(), nil
+	}
+
+	// fallback to LAST_CONFIG which is deprecated since fabric v2
+	metadata := block.GetMetadata().GetMetadata()
+	if len(metadata) <= int(common.BlockMetadataIndex_LAST_CONFIG) {
+		return 0, errors.New("no last config in block metadata")
+	}
+	lastConfigMetadata := &common.Metadata{}
+	if err = proto.Unmarshal(metadata[common.BlockMetadataIndex_LAST_CONFIG], lastConfigMetadata); err != nil {
+		return 0, errors.Wrap(err, "unmarshal last config metadata")
+	}
+	lastConfig := &common.LastConfig{}
+	if err = proto.Unmarshal(lastConfigMetadata.GetValue(), lastConfig); err != nil {
+		return 0, errors.Wrap(err, "unmarshal last config")
+	}
+	return lastConfig.GetIndex(), nil
+}
+
+// ChannelMSPs returns configurations of all organization MSPs(application and orderer) in a config block
+func ChannelMSPs(configBlock *common.Block) ([]*msp.FabricMSPConfig, error) {
+	if len(configBlock.GetData().GetData()) == 0 {
+		return nil, errors.New("empty config block")
+	}
+	env := &common.Envelope{}
+	if err := proto.Unmarshal(configBlock.GetData().GetData()[0], env); err != nil {
+		return nil, errors.Wrap(err, "unmarshal envelope")
+	}
+	payload, err := PayloadFromEnvelope(env)
+	if err != nil {
+		return nil, err
+	}
+	configEnv := &common.ConfigEnvelope{}
+	if err = proto.Unmarshal(payload.GetData(), configEnv); err != nil {
+		return nil, errors.Wrap(err, "unmarshal config envelope")
+	}
+
+	msps := make([]*msp.FabricMSPConfig, 0)
+	for _, groupName := range []string{"Application", "Orderer"} {
+		group, ok := configEnv.GetConfig().GetChannelGroup().GetGroups()[groupName]
+		if !ok {
+			continue
+		}
+		for orgName, org := range group.GetGroups() {
+			value, ok := org.GetValues()["MSP"]
+			if !ok {
+				continue
+			}
+			mspConfig := &msp.MSPConfig{}
+			if err = proto.Unmarshal(value.GetValue(), mspConfig); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal msp config of %s", orgName)
+			}
+			fabricMSPConfig := &msp.FabricMSPConfig{}
+			if err = proto.Unmarshal(mspConfig.GetConfig(), fabricMSPConfig); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal fabric msp config of %s", orgName)
+			}
+			msps = append(msps, fabricMSPConfig)
+		}
+	}
+	return msps, nil
+}
+
+// IsKeyOf returns true if key is id, or a composite key like "\x00objectType\x00id\x00"
+// of which the last attribute is id
+func IsKeyOf(key string, id string) bool {
+	if id == "" {
+		return false
+	}
+	if !strings.HasPrefix(key, "\x00") {
+		return key == id
+	}
+	parts := strings.Split(strings.TrimSuffix(key[1:], "\x00"), "\x00")
+	return len(parts) > 1 && parts[len(parts)-1] == id
+}
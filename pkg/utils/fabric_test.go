@@ -0,0 +1,36 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIsKeyOf tests only the exact id or last attribute of a composite key matches
+func TestIsKeyOf(t *testing.T) {
+	assert.True(t, IsKeyOf("kid1", "kid1"))
+	assert.True(t, IsKeyOf("\x00kid\x00kid1\x00", "kid1"))
+	assert.True(t, IsKeyOf("\x00kid\x00owner\x00kid1\x00", "kid1"))
+
+	assert.False(t, IsKeyOf("xkid1", "kid1"))
+	assert.False(t, IsKeyOf("\x00kid\x00xkid1\x00", "kid1"))
+	assert.False(t, IsKeyOf("\x00kid1\x00", "kid1"))
+	assert.False(t, IsKeyOf("\x00kid\x00kid1\x00other\x00", "kid1"))
+	assert.False(t, IsKeyOf("", ""))
+}
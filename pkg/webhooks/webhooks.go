@@ -0,0 +1,441 @@
+/*
+Copyright 2023 The Bestchains Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhooks delivers events of depositories to subscribed URLs
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/bestchains/bc-saas/pkg/models"
+)
+
+const (
+	// EventDepositoryCreated is sent once a depository is indexed
+	EventDepositoryCreated = "depository.created"
+
+	// headers of deliveries
+	HeaderEvent     = "X-Bestchains-Event"
+	HeaderDelivery  = "X-Bestchains-Delivery"
+	HeaderTimestamp = "X-Bestchains-Timestamp"
+	// HeaderSignature is "sha256=" + hex encoded HMAC-SHA256 of "{timestamp}.{body}" with secret
+	HeaderSignature = "X-Bestchains-Signature"
+
+	deliverInterval  = 5 * time.Second
+	deliverBatchSize = 20
+	deliverTimeout   = 10 * time.Second
+	// lease of a claimed delivery. It is retried if not finished in time
+	deliverLease = time.Minute
+	// retries of a delivery are delayed from 30s to 1h
+	minRetryDelay = 30 * time.Second
+	maxRetryDelay = time.Hour
+	maxAttempts   = 10
+)
+
+var (
+	// EventTypes supported by webhooks
+	EventTypes = []string{EventDepositoryCreated}
+
+	ErrInvalidSubscription = errors.New("invalid subscription")
+)
+
+// Event is the payload of a delivery
+type Event struct {
+	Type      string      `json:"type"`
+	CreatedAt int64       `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher stores webhook subscriptions and delivers events to them
+type Dispatcher struct {
+	db         *pg.DB
+	httpClient *http.Client
+	// allowPrivate allows URLs in loopback, private and link-local networks
+	allowPrivate bool
+}
+
+// NewDispatcher returns a dispatcher which only delivers to public addresses unless allowPrivate,
+// so that subscriptions can't reach internal services
+func NewDispatcher(db *pg.DB, allowPrivate bool) *Dispatcher {
+	dialer := &net.Dialer{Timeout: deliverTimeout}
+	if !allowPrivate {
+		// checked on dial, as a public host may resolve to, or redirect to, a private address
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+				return errors.Wrapf(ErrInvalidSubscription, "private address %s", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &Dispatcher{
+		db:           db,
+		httpClient:   &http.Client{Timeout: deliverTimeout, Transport: transport},
+		allowPrivate: allowPrivate,
+	}
+}
+
+// DepositoryCreated enqueues deliveries of depository d to matched subscriptions with db,
+// which is the transaction that inserts d
+func (d *Dispatcher) DepositoryCreated(db orm.DB, depository *models.Depository) error {
+	return d.enqueue(db, EventDepositoryCreated, depository.KID, depository.Owner, depository)
+}
+
+func (d *Dispatcher) enqueue(db orm.DB, eventType string, kid string, owner string, data interface{}) error {
+	subscriptions := make([]models.WebhookSubscription, 0)
+	err := db.Model(&subscriptions).
+		Where("active = TRUE").
+		Where(`("eventTypes" IS NULL OR cardinality("eventTypes") = 0 OR ? = ANY("eventTypes"))`, eventType).
+		Where(`(owner = '' OR owner IS NULL OR owner = ?)`, owner).
+		Select()
+	if err != nil {
+		return errors.Wrap(err, "select webhook subscriptions")
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	payload, err := json.Marshal(&Event{Type: eventType, CreatedAt: now, Data: data})
+	if err != nil {
+		return errors.Wrap(err, "marshal webhook event")
+	}
+	deliveries := make([]models.WebhookDelivery, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: s.ID,
+			EventType:      eventType,
+			KID:            kid,
+			Payload:        payload,
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	if _, err = db.Model(&deliveries).Insert(); err != nil {
+		return errors.Wrap(err, "insert webhook deliveries")
+	}
+	return nil
+}
+
+// Run delivers pending deliveries when they are due until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(deliverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deliveries, err := d.claim(ctx)
+			if err != nil {
+				klog.Errorf("[Error] claim webhook deliveries: %s", err)
+				continue
+			}
+			for i := range deliveries {
+				d.deliver(ctx, &deliveries[i])
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// claim takes due deliveries and delays them by deliverLease, so they are delivered
+// by only one dispatcher unless it fails to finish in time
+func (d *Dispatcher) claim(ctx context.Context) ([]models.WebhookDelivery, error) {
+	deliveries := make([]models.WebhookDelivery, 0)
+	now := time.Now()
+	_, err := d.db.ModelContext(ctx, &deliveries).
+		Set(`"nextAttemptAt" = ?`, now.Add(deliverLease).Unix()).
+		Where(`id IN (?)`, d.db.Model((*models.WebhookDelivery)(nil)).
+			Column("id").
+			Where("status = ?", models.WebhookDeliveryPending).
+			Where(`"nextAttemptAt" <= ?`, now.Unix()).
+			Order("id ASC").
+			Limit(deliverBatchSize).
+			For("UPDATE SKIP LOCKED")).
+		Returning("*").
+		Update()
+	if err == pg.ErrNoRows {
+		return deliveries, nil
+	}
+	return deliveries, err
+}
+
+// deliver posts delivery to its subscription and records the attempt
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	subscription := models.WebhookSubscription{ID: delivery.SubscriptionID}
+	err := d.db.ModelContext(ctx, &subscription).WherePK().Select()
+	if err != nil && err != pg.ErrNoRows {
+		klog.Errorf("[Error] get webhook subscription %d: %s", delivery.SubscriptionID, err)
+		return
+	}
+
+	gone := err == pg.ErrNoRows || !subscription.Active
+	start := time.Now()
+	attempt := models.WebhookAttempt{DeliveryID: delivery.ID, CreatedAt: start.Unix()}
+	if gone {
+		attempt.Error = "subscription is deleted or inactive"
+	} else {
+		attempt.StatusCode, err = d.post(ctx, &subscription, delivery)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}
+	attempt.Duration = time.Since(start).Milliseconds()
+
+	delivery.Attempts++
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+	delivery.UpdatedAt = time.Now().Unix()
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.WebhookDeliverySucceeded
+	case gone || delivery.Attempts >= maxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+	default:
+		delivery.NextAttemptAt = time.Now().Add(retryDelay(delivery.Attempts)).Unix()
+	}
+
+	err = d.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.Model(&attempt).Insert(); err != nil {
+			return err
+		}
+		_, err := tx.Model(delivery).
+			Column("status", "attempts", "nextAttemptAt", "lastStatusCode", "lastError", "updatedAt").
+			WherePK().
+			Update()
+		return err
+	})
+	if err != nil {
+		klog.Errorf("[Error] record webhook delivery %d: %s", delivery.ID, err)
+		return
+	}
+	if delivery.Status == models.WebhookDeliverySucceeded {
+		klog.Infof("[Success] deliver %s of %s to webhook %d", delivery.EventType, delivery.KID, delivery.SubscriptionID)
+	} else {
+		klog.Errorf("[Error] deliver %s of %s to webhook %d: %s", delivery.EventType, delivery.KID, delivery.SubscriptionID, delivery.LastError)
+	}
+}
+
+// post sends a signed delivery. Only 2xx responses are successful.
+func (d *Dispatcher) post(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responds with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header of body sent at timestamp
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay doubles from minRetryDelay on each attempt
+func retryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// CreateSubscription creates a subscription. A secret is generated if not provided.
+func (d *Dispatcher) CreateSubscription(s *models.WebhookSubscription) error {
+	if err := d.validate(s); err != nil {
+		return err
+	}
+	if s.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		s.Secret = hex.EncodeToString(secret)
+	}
+	s.ID = 0
+	s.CreatedAt = time.Now().Unix()
+	s.UpdatedAt = s.CreatedAt
+	_, err := d.db.Model(s).Insert()
+	return err
+}
+
+// ListSubscriptions lists subscriptions without secrets
+func (d *Dispatcher) ListSubscriptions() ([]models.WebhookSubscription, error) {
+	subscriptions := make([]models.WebhookSubscription, 0)
+	if err := d.db.Model(&subscriptions).ExcludeColumn("secret").Order("id ASC").Select(); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription gets a subscription without secret
+func (d *Dispatcher) GetSubscription(id int64) (models.WebhookSubscription, error) {
+	s := models.WebhookSubscription{ID: id}
+	err := d.db.Model(&s).ExcludeColumn("secret").WherePK().Select()
+	return s, err
+}
+
+// UpdateSubscription updates url, event types, owner and active of a subscription.
+// Secret is updated only if provided.
+func (d *Dispatcher) UpdateSubscription(s *models.WebhookSubscription) error {
+	if err := d.validate(s); err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now().Unix()
+	columns := []string{"url", "eventTypes", "owner", "active", "updatedAt"}
+	if s.Secret != "" {
+		columns = append(columns, "secret")
+	}
+	result, err := d.db.Model(s).Column(columns...).WherePK().Update()
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSubscription deletes a subscription. Its pending deliveries will fail.
+func (d *Dispatcher) DeleteSubscription(id int64) error {
+	result, err := d.db.Model(&models.WebhookSubscription{ID: id}).WherePK().Delete()
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// ListDeliveries lists deliveries of a subscription with their attempts
+func (d *Dispatcher) ListDeliveries(subscriptionID int64, status models.WebhookDeliveryStatus, from, size int) ([]models.WebhookDelivery, int64, error) {
+	deliveries := make([]models.WebhookDelivery, 0)
+	q := d.db.Model(&deliveries).Where(`"subscriptionID" = ?`, subscriptionID).Order("id DESC").Offset(from).Limit(size)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	count, err := q.SelectAndCount()
+	return deliveries, int64(count), err
+}
+
+// ListAttempts lists attempts of a delivery
+func (d *Dispatcher) ListAttempts(deliveryID int64) ([]models.WebhookAttempt, error) {
+	attempts := make([]models.WebhookAttempt, 0)
+	err := d.db.Model(&attempts).Where(`"deliveryID" = ?`, deliveryID).Order("id ASC").Select()
+	return attempts, err
+}
+
+// Redeliver delivers a delivery again as soon as possible, no matter its status
+func (d *Dispatcher) Redeliver(id int64) (models.WebhookDelivery, error) {
+	delivery := models.WebhookDelivery{ID: id}
+	result, err := d.db.Model(&delivery).
+		Set("status = ?", models.WebhookDeliveryPending).
+		Set(`"nextAttemptAt" = ?`, time.Now().Unix()).
+		Set(`"updatedAt" = ?`, time.Now().Unix()).
+		WherePK().
+		Returning("*").
+		Update()
+	if err != nil {
+		return delivery, err
+	}
+	if result.RowsAffected() == 0 {
+		return delivery, pg.ErrNoRows
+	}
+	return delivery, nil
+}
+
+// isPrivate returns true if ip is not a public unicast address
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+func (d *Dispatcher) validate(s *models.WebhookSubscription) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return errors.Wrapf(ErrInvalidSubscription, "invalid url %q", s.URL)
+	}
+	if !d.allowPrivate {
+		host := strings.ToLower(u.Hostname())
+		if ip := net.ParseIP(host); (ip != nil && isPrivate(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return errors.Wrapf(ErrInvalidSubscription, "private url %q", s.URL)
+		}
+	}
+	for _, t := range s.EventTypes {
+		supported := false
+		for _, eventType := range EventTypes {
+			supported = supported || t == eventType
+		}
+		if !supported {
+			return errors.Wrapf(ErrInvalidSubscription, "unsupported event type %q", t)
+		}
+	}
+	if s.EventTypes == nil {
+		s.EventTypes = []string{}
+	}
+	return nil
+}